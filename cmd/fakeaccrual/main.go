@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rshafikov/gophermart/internal/core/logger"
+	"github.com/rshafikov/gophermart/internal/fakeaccrual"
+	"github.com/rshafikov/gophermart/internal/middlewares"
+	"go.uber.org/zap"
+	"log"
+	"net/http"
+	"os"
+)
+
+func main() {
+	var cfg fakeaccrual.Config
+	address := flag.String("a", "localhost:8081", "run address")
+	logLevel := flag.String("l", "info", "log level")
+	flag.DurationVar(&cfg.Latency, "latency", 0, "delay added to every order lookup")
+	flag.DurationVar(&cfg.ProcessingDelay, "processing-delay", 0, "time before an order gets its final status")
+	flag.Float64Var(&cfg.InvalidRatio, "invalid-ratio", 0, "fraction of orders that end up INVALID, 0..1")
+	flag.Float64Var(&cfg.MinAccrual, "min-accrual", 0, "min accrual for auto-registered orders")
+	flag.Float64Var(&cfg.MaxAccrual, "max-accrual", 0, "max accrual for auto-registered orders")
+	flag.IntVar(&cfg.RequestsPerMinute, "rpm", 0, "order lookups allowed per minute, 0 is unlimited")
+	flag.BoolVar(&cfg.AutoRegister, "auto", false, "register unknown orders on first lookup instead of answering 204")
+	flag.Parse()
+
+	if env := os.Getenv("RUN_ADDRESS"); env != "" {
+		*address = env
+	}
+	if cfg.InvalidRatio < 0 || cfg.InvalidRatio > 1 || cfg.MinAccrual > cfg.MaxAccrual {
+		log.Fatal("invalid-ratio must be in [0, 1] and min-accrual must not exceed max-accrual")
+	}
+	if err := logger.Initialize(*logLevel); err != nil {
+		log.Fatal("unable to initialize logger:", err)
+	}
+
+	r := chi.NewRouter()
+	r.Use(middlewares.Logger)
+	r.Use(middleware.Recoverer)
+	r.Mount("/", fakeaccrual.New(cfg).Routes())
+
+	logger.L.Info("fake accrual system is listening", zap.String("address", *address))
+	if err := http.ListenAndServe(*address, r); err != nil {
+		logger.L.Fatal("listening error", zap.Error(err))
+	}
+}
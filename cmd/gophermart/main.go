@@ -3,27 +3,98 @@ package main
 import (
 	"context"
 	"github.com/go-chi/chi/v5"
+	"github.com/rshafikov/gophermart/internal/accrual"
 	"github.com/rshafikov/gophermart/internal/app"
 	"github.com/rshafikov/gophermart/internal/core/logger"
 	"github.com/rshafikov/gophermart/internal/core/security"
+	"github.com/rshafikov/gophermart/internal/core/tracing"
+	"github.com/rshafikov/gophermart/internal/middlewares"
 	"github.com/rshafikov/gophermart/internal/repository"
 	"github.com/rshafikov/gophermart/internal/router"
 	"github.com/rshafikov/gophermart/internal/service"
+	"github.com/rshafikov/gophermart/internal/workers"
 	"go.uber.org/zap"
 )
 
 func main() {
 	app.InitConfig()
 
+	shutdownTracing, err := tracing.Initialize(context.Background(), app.Config.Tracing.Exporter, app.Config.Tracing.Endpoint)
+	if err != nil {
+		logger.L.Fatal("tracing init error", zap.Error(err))
+	}
+	defer shutdownTracing(context.Background())
+
 	Application := app.NewApplication(app.Config)
 	if err := Application.ConnectToDatabase(context.Background()); err != nil {
 		logger.L.Fatal("database connect error", zap.Error(err))
 	}
 
-	jwtHanlder := security.NewJWTHandler()
+	jwtHanlder := security.NewJWTHandler(app.Config.JWT.Secret, app.Config.JWT.TokenTTL)
 	userRepository := repository.NewUserRepository(Application.DB.Pool)
 	userService := service.NewUserService(userRepository)
-	mainRouter := router.NewRouter(userService, jwtHanlder)
+	orderRepository := repository.NewOrderRepository(Application.DB.Pool)
+	orderService := service.NewOrderService(orderRepository)
+	ledgerRepository := repository.NewLedgerRepository(Application.DB.Pool)
+	withdrawalRepository := repository.NewWithdrawalRepository(Application.DB.Pool)
+	transferRepository := repository.NewTransferRepository(Application.DB.Pool)
+	balanceService := service.NewBalanceService(ledgerRepository, withdrawalRepository, orderRepository)
+	if expiration := app.Config.Expiration; expiration.Months > 0 {
+		// Debits write off expired points themselves, so they cannot be
+		// spent between two runs of the expirer.
+		ledgerRepository.Expiry = expiration.Policy()
+		withdrawalRepository.Expiry = expiration.Policy()
+		transferRepository.Expiry = expiration.Policy()
+		balanceService.Expiry = expiration.Policy()
+		Application.Go(workers.NewPointsExpirer(balanceService, expiration.Interval).Run)
+	}
+	mainRouter := router.NewRouter(userService, orderService, balanceService, jwtHanlder)
+	mainRouter.TransferService = service.NewTransferService(transferRepository, app.Config.Transfers.Limits())
+	mainRouter.AuditService = service.NewAuditService(repository.NewAuditRepository(Application.DB.Pool))
+
+	idempotencyRepository := repository.NewIdempotencyRepository(Application.DB.Pool)
+	mainRouter.IdempotencyKeys = idempotencyRepository
+	mainRouter.IdempotencyTTL = app.Config.Server.IdempotencyTTL
+	Application.Go(workers.NewIdempotencyCleaner(idempotencyRepository, workers.DefaultIdempotencyCleanupInterval).Run)
+
+	trustedProxies, err := middlewares.ParseTrustedProxies(app.Config.RateLimit.TrustedProxies)
+	if err != nil {
+		logger.L.Fatal("invalid trusted proxies", zap.Error(err))
+	}
+	if rl := app.Config.RateLimit; rl.PublicRate > 0 {
+		mainRouter.PublicLimiter = middlewares.NewRateLimiter(middlewares.RateLimitConfig{
+			Rate: rl.PublicRate, Burst: rl.PublicBurst, TrustedProxies: trustedProxies,
+		})
+	}
+	if rl := app.Config.RateLimit; rl.UserRate > 0 {
+		mainRouter.UserLimiter = middlewares.NewRateLimiter(middlewares.RateLimitConfig{
+			Rate: rl.UserRate, Burst: rl.UserBurst, TrustedProxies: trustedProxies,
+		})
+	}
+	if rl := app.Config.RateLimit; rl.AuthRate > 0 {
+		mainRouter.AuthLimiter = middlewares.NewRateLimiter(middlewares.RateLimitConfig{
+			Rate: rl.AuthRate, Burst: rl.AuthBurst, TrustedProxies: trustedProxies,
+		})
+	}
+
+	accrualCfg := app.Config.Accrual
+	if accrualCfg.Pushing() {
+		mainRouter.AccrualCallbackSecret = []byte(accrualCfg.CallbackSecret)
+		mainRouter.AccrualCallbackMaxSkew = accrualCfg.CallbackMaxSkew
+	}
+	if accrualCfg.Address.Host != "" {
+		orderService.AccrualClient = accrual.NewHTTPClient(accrualCfg.ClientConfig())
+	}
+	if accrualCfg.Polling() {
+		if orderService.AccrualClient == nil {
+			logger.L.Warn("accrual system address is not set, orders will not be polled")
+		} else {
+			accrualJobs := repository.NewAccrualJobRepository(Application.DB.Pool)
+			poller := workers.NewAccrualPoller(orderService, accrualJobs, orderService.AccrualClient, app.Config.Workers.PollerConfig())
+			Application.Go(poller.Run)
+		}
+	}
+
 	r := chi.NewRouter()
 	r.Mount("/", mainRouter.Routes())
 
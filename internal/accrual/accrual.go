@@ -0,0 +1,57 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusRegistered Status = "REGISTERED"
+	StatusInvalid    Status = "INVALID"
+	StatusProcessing Status = "PROCESSING"
+	StatusProcessed  Status = "PROCESSED"
+)
+
+// IsFinal reports whether the accrual system will not change the status anymore.
+func (s Status) IsFinal() bool {
+	return s == StatusInvalid || s == StatusProcessed
+}
+
+// OrderAccrual is the accrual system's answer for a single order.
+// Accrual is nil when the response carries no accrual.
+type OrderAccrual struct {
+	Order   string   `json:"order"`
+	Status  Status   `json:"status"`
+	Accrual *float64 `json:"accrual,omitempty"`
+}
+
+var (
+	ErrOrderNotRegistered = errors.New("order is not registered in accrual system")
+	ErrTooManyRequests    = errors.New("accrual system rate limit exceeded")
+	ErrUnavailable        = errors.New("accrual system is unavailable")
+	ErrUnexpectedResponse = errors.New("unexpected response from accrual system")
+	ErrCircuitOpen        = errors.New("accrual system circuit breaker is open")
+)
+
+// RateLimitError is returned on 429. RetryAfter is zero when the response
+// did not carry a usable Retry-After header.
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrTooManyRequests, e.RetryAfter)
+}
+
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrTooManyRequests
+}
+
+// Client fetches accrual information for orders.
+type Client interface {
+	GetOrderAccrual(ctx context.Context, number string) (*OrderAccrual, error)
+}
@@ -0,0 +1,106 @@
+// Package accrualtest provides an in-memory accrual system served by httptest.
+package accrualtest
+
+import (
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/rshafikov/gophermart/internal/accrual"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// Server implements GET /api/orders/{number} of the accrual system.
+// Unknown orders are answered with 204.
+type Server struct {
+	*httptest.Server
+	prefix string
+
+	mu     sync.Mutex
+	orders map[string]accrual.OrderAccrual
+	// failures are status codes returned, one per request, before the normal answer.
+	failures   []int
+	retryAfter int
+
+	requests atomic.Int64
+}
+
+func NewServer() *Server {
+	return NewServerAt("")
+}
+
+// NewServerAt serves the accrual API under the path prefix, like a system
+// behind a reverse proxy.
+func NewServerAt(prefix string) *Server {
+	s := &Server{prefix: prefix, orders: make(map[string]accrual.OrderAccrual)}
+
+	r := chi.NewRouter()
+	r.Get(prefix+"/api/orders/{number}", s.getOrder)
+	s.Server = httptest.NewServer(r)
+
+	return s
+}
+
+// BaseURL returns the server URL, with the prefix, ready for accrual.Config.
+func (s *Server) BaseURL() url.URL {
+	u, _ := url.Parse(s.URL)
+	u.Path = s.prefix
+	return *u
+}
+
+func (s *Server) SetOrder(number string, status accrual.Status, amount *float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.orders[number] = accrual.OrderAccrual{Order: number, Status: status, Accrual: amount}
+}
+
+// FailNext makes the next len(codes) requests fail with the given status codes.
+func (s *Server) FailNext(codes ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, codes...)
+}
+
+// SetRetryAfter sets the Retry-After seconds sent with 429 responses.
+func (s *Server) SetRetryAfter(seconds int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retryAfter = seconds
+}
+
+// Requests returns the number of requests served so far.
+func (s *Server) Requests() int {
+	return int(s.requests.Load())
+}
+
+func (s *Server) getOrder(w http.ResponseWriter, r *http.Request) {
+	s.requests.Add(1)
+
+	s.mu.Lock()
+	var failure int
+	if len(s.failures) > 0 {
+		failure, s.failures = s.failures[0], s.failures[1:]
+	}
+	order, ok := s.orders[chi.URLParam(r, "number")]
+	retryAfter := s.retryAfter
+	s.mu.Unlock()
+
+	if failure != 0 {
+		if failure == http.StatusTooManyRequests && retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		}
+		http.Error(w, http.StatusText(failure), failure)
+		return
+	}
+
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(order)
+}
@@ -0,0 +1,51 @@
+package accrual
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := newBreaker(2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	b.failure()
+	assert.True(t, b.allow(), "below threshold")
+	b.failure()
+	assert.False(t, b.allow(), "opened after threshold")
+
+	now = now.Add(time.Minute)
+	assert.True(t, b.allow(), "half-open probe after cooldown")
+	assert.False(t, b.allow(), "only one probe at a time")
+
+	b.failure()
+	assert.False(t, b.allow(), "failed probe reopens")
+
+	now = now.Add(time.Minute)
+	assert.True(t, b.allow())
+	b.success()
+	assert.True(t, b.allow(), "successful probe closes")
+	assert.True(t, b.allow())
+
+	b.failure()
+	b.release()
+	b.failure()
+	assert.False(t, b.allow(), "released calls do not reset failures")
+
+	now = now.Add(time.Minute)
+	assert.True(t, b.allow())
+	b.release()
+	assert.True(t, b.allow(), "inconclusive probe lets another one through")
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, 5*time.Second, parseRetryAfter("5", now))
+	assert.Equal(t, 30*time.Second, parseRetryAfter(now.Add(30*time.Second).Format(http.TimeFormat), now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon", now))
+}
@@ -0,0 +1,227 @@
+package accrual
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rshafikov/gophermart/internal/core/logger"
+	"github.com/rshafikov/gophermart/internal/core/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultTimeout          = 5 * time.Second
+	DefaultMaxRetries       = 3
+	DefaultInitialBackoff   = 100 * time.Millisecond
+	DefaultMaxBackoff       = 2 * time.Second
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 10 * time.Second
+)
+
+type Config struct {
+	// BaseURL is the accrual system URL, may contain a path prefix.
+	BaseURL url.URL
+	// Timeout bounds every single HTTP attempt.
+	Timeout time.Duration
+	// MaxRetries is the number of retries after the first attempt for
+	// transient failures (network errors and 5xx).
+	MaxRetries     int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// BreakerThreshold is the number of consecutive transient failures that
+	// opens the circuit for BreakerCooldown; 0 disables the breaker.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	// Transport defaults to http.DefaultTransport wrapped for tracing.
+	Transport http.RoundTripper
+}
+
+// HTTPClient talks to the accrual system over HTTP.
+type HTTPClient struct {
+	cfg     Config
+	http    *http.Client
+	breaker *breaker
+	sleep   func(ctx context.Context, d time.Duration) error
+}
+
+func NewHTTPClient(cfg Config) *HTTPClient {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	}
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = DefaultInitialBackoff
+	}
+	if cfg.MaxBackoff < cfg.InitialBackoff {
+		cfg.MaxBackoff = max(DefaultMaxBackoff, cfg.InitialBackoff)
+	}
+
+	return &HTTPClient{
+		cfg:     cfg,
+		http:    &http.Client{Transport: tracing.NewTransport(cfg.Transport)},
+		breaker: newBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown),
+		sleep:   sleepCtx,
+	}
+}
+
+// GetOrderAccrual requests GET /api/orders/{number}. It returns
+// ErrOrderNotRegistered on 204, a *RateLimitError on 429, ErrUnavailable once
+// retries for 5xx and network errors are exhausted and ErrCircuitOpen while
+// the circuit breaker rejects calls.
+func (c *HTTPClient) GetOrderAccrual(ctx context.Context, number string) (_ *OrderAccrual, err error) {
+	ctx, span := tracing.Start(ctx, "accrual.GetOrderAccrual", attribute.String("order.number", number))
+	defer func() { tracing.End(span, err) }()
+
+	for attempt := 0; ; attempt++ {
+		if !c.breaker.allow() {
+			return nil, ErrCircuitOpen
+		}
+
+		// Only an answer the accrual system is expected to give counts as a
+		// success; unexpected responses and cancellations prove nothing.
+		res, err := c.fetch(ctx, number)
+		switch {
+		case err == nil, errors.Is(err, ErrOrderNotRegistered), errors.Is(err, ErrTooManyRequests):
+			c.breaker.success()
+			return res, err
+		case !errors.Is(err, ErrUnavailable):
+			c.breaker.release()
+			return nil, err
+		}
+		c.breaker.failure()
+
+		if attempt >= c.cfg.MaxRetries {
+			return nil, err
+		}
+
+		delay := c.backoff(attempt)
+		logger.L.Debug("accrual request failed, retrying",
+			zap.String("order", number),
+			zap.Int("attempt", attempt+1),
+			zap.Duration("backoff", delay),
+			zap.Error(err),
+		)
+		if err := c.sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (c *HTTPClient) fetch(ctx context.Context, number string) (*OrderAccrual, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+
+	endpoint := c.cfg.BaseURL.JoinPath("api", "orders", number)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if parent := context.Cause(ctx); parent != nil && !errors.Is(parent, context.DeadlineExceeded) {
+			return nil, parent
+		}
+		return nil, fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		var res OrderAccrual
+		if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrUnexpectedResponse, err)
+		}
+		if res.Order != number {
+			return nil, fmt.Errorf("%w: asked for order %s, got %s", ErrUnexpectedResponse, number, res.Order)
+		}
+		return &res, nil
+	case resp.StatusCode == http.StatusNoContent:
+		return nil, ErrOrderNotRegistered
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return nil, &RateLimitError{RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())}
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return nil, fmt.Errorf("%w: status %d", ErrUnavailable, resp.StatusCode)
+	default:
+		return nil, fmt.Errorf("%w: status %d", ErrUnexpectedResponse, resp.StatusCode)
+	}
+}
+
+// backoff returns a "full jitter" delay: random in [0, min(max, initial*2^attempt)].
+func (c *HTTPClient) backoff(attempt int) time.Duration {
+	ceiling := c.cfg.InitialBackoff << min(attempt, 30)
+	if ceiling <= 0 || ceiling > c.cfg.MaxBackoff {
+		ceiling = c.cfg.MaxBackoff
+	}
+	return rand.N(ceiling + 1)
+}
+
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(header); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// MockClient is an in-memory Client for service tests.
+type MockClient struct {
+	mu     sync.Mutex
+	Orders map[string]*OrderAccrual
+	// Err, when set, is returned for every call.
+	Err   error
+	Calls int
+}
+
+func NewMockClient() *MockClient {
+	return &MockClient{Orders: make(map[string]*OrderAccrual)}
+}
+
+func (m *MockClient) Set(number string, status Status, accrual *float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Orders[number] = &OrderAccrual{Order: number, Status: status, Accrual: accrual}
+}
+
+func (m *MockClient) GetOrderAccrual(ctx context.Context, number string) (*OrderAccrual, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Calls++
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	res, ok := m.Orders[number]
+	if !ok {
+		return nil, ErrOrderNotRegistered
+	}
+	cp := *res
+	return &cp, nil
+}
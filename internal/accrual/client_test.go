@@ -0,0 +1,132 @@
+package accrual_test
+
+import (
+	"context"
+	"github.com/rshafikov/gophermart/internal/accrual"
+	"github.com/rshafikov/gophermart/internal/accrual/accrualtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func newClient(srv *accrualtest.Server, breakerThreshold int) *accrual.HTTPClient {
+	return accrual.NewHTTPClient(accrual.Config{
+		BaseURL:          srv.BaseURL(),
+		Timeout:          time.Second,
+		MaxRetries:       2,
+		InitialBackoff:   time.Millisecond,
+		MaxBackoff:       2 * time.Millisecond,
+		BreakerThreshold: breakerThreshold,
+		BreakerCooldown:  time.Hour,
+	})
+}
+
+func TestHTTPClient_GetOrderAccrual(t *testing.T) {
+	srv := accrualtest.NewServer()
+	defer srv.Close()
+
+	amount := 729.98
+	srv.SetOrder("12345678903", accrual.StatusProcessed, &amount)
+	srv.SetOrder("9278923470", accrual.StatusProcessing, nil)
+
+	client := newClient(srv, 0)
+	ctx := context.Background()
+
+	res, err := client.GetOrderAccrual(ctx, "12345678903")
+	require.NoError(t, err)
+	assert.Equal(t, accrual.StatusProcessed, res.Status)
+	require.NotNil(t, res.Accrual)
+	assert.Equal(t, amount, *res.Accrual)
+
+	res, err = client.GetOrderAccrual(ctx, "9278923470")
+	require.NoError(t, err)
+	assert.Equal(t, accrual.StatusProcessing, res.Status)
+	assert.Nil(t, res.Accrual)
+
+	_, err = client.GetOrderAccrual(ctx, "346436439")
+	assert.ErrorIs(t, err, accrual.ErrOrderNotRegistered)
+}
+
+func TestHTTPClient_RetriesServerErrors(t *testing.T) {
+	srv := accrualtest.NewServer()
+	defer srv.Close()
+	srv.SetOrder("1", accrual.StatusRegistered, nil)
+	client := newClient(srv, 0)
+
+	srv.FailNext(http.StatusInternalServerError, http.StatusBadGateway)
+	res, err := client.GetOrderAccrual(context.Background(), "1")
+	require.NoError(t, err)
+	assert.Equal(t, accrual.StatusRegistered, res.Status)
+	assert.Equal(t, 3, srv.Requests())
+
+	srv.FailNext(http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	_, err = client.GetOrderAccrual(context.Background(), "1")
+	assert.ErrorIs(t, err, accrual.ErrUnavailable)
+	assert.Equal(t, 6, srv.Requests())
+}
+
+func TestHTTPClient_RateLimited(t *testing.T) {
+	srv := accrualtest.NewServer()
+	defer srv.Close()
+	srv.SetRetryAfter(60)
+	srv.FailNext(http.StatusTooManyRequests)
+
+	_, err := newClient(srv, 0).GetOrderAccrual(context.Background(), "1")
+
+	require.ErrorIs(t, err, accrual.ErrTooManyRequests)
+	var rlErr *accrual.RateLimitError
+	require.ErrorAs(t, err, &rlErr)
+	assert.Equal(t, time.Minute, rlErr.RetryAfter)
+	assert.Equal(t, 1, srv.Requests(), "429 is not retried by the client")
+}
+
+func TestHTTPClient_CircuitBreaker(t *testing.T) {
+	srv := accrualtest.NewServer()
+	defer srv.Close()
+	srv.FailNext(500, 500, 500, 500)
+	client := newClient(srv, 3)
+
+	_, err := client.GetOrderAccrual(context.Background(), "1")
+	assert.ErrorIs(t, err, accrual.ErrUnavailable)
+
+	_, err = client.GetOrderAccrual(context.Background(), "1")
+	assert.ErrorIs(t, err, accrual.ErrCircuitOpen)
+	assert.Equal(t, 3, srv.Requests(), "no requests while the circuit is open")
+}
+
+func TestHTTPClient_UnexpectedResponsesKeepFailures(t *testing.T) {
+	srv := accrualtest.NewServer()
+	defer srv.Close()
+	srv.FailNext(500, 404, 500)
+	client := accrual.NewHTTPClient(accrual.Config{BaseURL: srv.BaseURL(), BreakerThreshold: 2, BreakerCooldown: time.Hour})
+
+	_, err := client.GetOrderAccrual(context.Background(), "1")
+	assert.ErrorIs(t, err, accrual.ErrUnavailable)
+	_, err = client.GetOrderAccrual(context.Background(), "1")
+	assert.ErrorIs(t, err, accrual.ErrUnexpectedResponse)
+	_, err = client.GetOrderAccrual(context.Background(), "1")
+	assert.ErrorIs(t, err, accrual.ErrUnavailable)
+
+	_, err = client.GetOrderAccrual(context.Background(), "1")
+	assert.ErrorIs(t, err, accrual.ErrCircuitOpen, "the 404 did not reset the failure count")
+}
+
+func TestHTTPClient_BasePath(t *testing.T) {
+	srv := accrualtest.NewServerAt("/accrual")
+	defer srv.Close()
+	amount := 500.0
+	srv.SetOrder("12345678903", accrual.StatusProcessed, &amount)
+
+	client := accrual.NewHTTPClient(accrual.Config{BaseURL: srv.BaseURL(), MaxRetries: 0})
+	res, err := client.GetOrderAccrual(context.Background(), "12345678903")
+	require.NoError(t, err)
+	assert.Equal(t, accrual.StatusProcessed, res.Status)
+	assert.Equal(t, &amount, res.Accrual)
+
+	root := srv.BaseURL()
+	root.Path = ""
+	_, err = accrual.NewHTTPClient(accrual.Config{BaseURL: root, MaxRetries: 0}).GetOrderAccrual(context.Background(), "12345678903")
+	assert.ErrorIs(t, err, accrual.ErrUnexpectedResponse, "the API is not served without the prefix")
+}
@@ -3,8 +3,6 @@ package app
 import (
 	"context"
 	"errors"
-	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/rshafikov/gophermart/internal/core/logger"
 	"github.com/rshafikov/gophermart/internal/database"
@@ -13,49 +11,85 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"sync"
 	"syscall"
-	"time"
 )
 
 type Application struct {
-	Config defaultConfig
+	Config AppConfig
 	DB     *database.DB
+
+	workersCtx  context.Context
+	stopWorkers context.CancelFunc
+	workers     sync.WaitGroup
 }
 
-func NewApplication(cfg defaultConfig) *Application {
+func NewApplication(cfg AppConfig) *Application {
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
 	return &Application{
-		Config: cfg,
-		DB:     &database.DB{},
+		Config:      cfg,
+		DB:          &database.DB{},
+		workersCtx:  workersCtx,
+		stopWorkers: stopWorkers,
 	}
 }
 
+// Go runs a background worker. Its context is cancelled on shutdown, after
+// the HTTP server has stopped and before the database pool is closed.
+func (app *Application) Go(worker func(ctx context.Context)) {
+	app.workers.Add(1)
+	go func() {
+		defer app.workers.Done()
+		worker(app.workersCtx)
+	}()
+}
+
 func (app *Application) ConnectToDatabase(ctx context.Context) error {
-	dsn := app.Config.DB.URI
-	_, err := pgx.Connect(ctx, dsn)
+	cfg := app.Config.DB
+	dsn, err := cfg.DSN()
 	if err != nil {
-		var pgErr *pgconn.ConnectError
-		if errors.As(err, &pgErr) {
-			logger.L.Debug("unable to connect to database", zap.String("DB_URI", dsn))
-			return database.ErrConnectDB
-		}
 		return err
 	}
 
-	app.DB.Pool, err = pgxpool.New(ctx, dsn)
+	poolConfig, err := pgxpool.ParseConfig(dsn.Raw())
+	if err != nil {
+		return err
+	}
+	poolConfig.ConnConfig.Tracer = &database.QueryTracer{}
+	poolConfig.MaxConns = cfg.MaxConns
+	poolConfig.MinConns = cfg.MinConns
+	poolConfig.MinIdleConns = cfg.MinIdleConns
+	poolConfig.MaxConnLifetime = cfg.MaxConnLifetime
+	poolConfig.MaxConnIdleTime = cfg.MaxConnIdleTime
+	poolConfig.HealthCheckPeriod = cfg.HealthCheckPeriod
+	if cfg.StatementTimeout > 0 {
+		poolConfig.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(cfg.StatementTimeout.Milliseconds(), 10)
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
 		return err
 	}
 
-	err = app.DB.Pool.Ping(ctx)
+	err = database.WaitForDB(ctx, pool, database.RetryPolicy{
+		Attempts:       cfg.ConnectAttempts,
+		InitialBackoff: cfg.ConnectBackoff,
+		MaxBackoff:     cfg.ConnectMaxBackoff,
+	})
 	if err != nil {
+		pool.Close()
+		logger.L.Debug("unable to connect to database", zap.Stringer("DB_URI", &dsn))
 		return err
 	}
-	log.Println("Connected to database:", dsn)
+
+	app.DB.Pool = pool
+	log.Println("Connected to database:", dsn.Redacted())
 	return nil
 }
 
 func (app *Application) RunServer(router http.Handler) {
-	server := http.Server{Addr: app.Config.RunAddress.String(), Handler: router}
+	server := http.Server{Addr: app.Config.Server.RunAddress.String(), Handler: router}
 	serverCtx, serverStopCtx := context.WithCancel(context.Background())
 
 	sig := make(chan os.Signal, 1)
@@ -63,7 +97,7 @@ func (app *Application) RunServer(router http.Handler) {
 	go func() {
 		sigReceived := <-sig
 		logger.L.Debug("received shutdown signal", zap.String("signal", sigReceived.String()))
-		shutdownCtx, shutdownCancelCtx := context.WithTimeout(serverCtx, 5*time.Second)
+		shutdownCtx, shutdownCancelCtx := context.WithTimeout(serverCtx, app.Config.Server.ShutdownTimeout)
 		defer shutdownCancelCtx()
 
 		go func() {
@@ -77,6 +111,11 @@ func (app *Application) RunServer(router http.Handler) {
 		if err != nil {
 			logger.L.Fatal("shutdowning error", zap.Error(err))
 		}
+		app.stopWorkers()
+		app.workers.Wait()
+		logger.L.Debug("background workers stopped")
+		app.DB.Close()
+		logger.L.Debug("database pool closed")
 		serverStopCtx()
 		logger.L.Debug("graceful shutdown completed")
 	}()
@@ -1,56 +1,423 @@
 package app
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"github.com/rshafikov/gophermart/internal/accrual"
 	"github.com/rshafikov/gophermart/internal/core/logger"
+	"github.com/rshafikov/gophermart/internal/core/tracing"
+	"github.com/rshafikov/gophermart/internal/database"
+	"github.com/rshafikov/gophermart/internal/middlewares"
+	"github.com/rshafikov/gophermart/internal/models"
+	"github.com/rshafikov/gophermart/internal/service"
+	"github.com/rshafikov/gophermart/internal/workers"
+	"go.uber.org/zap"
 	"log"
-	"net"
-	"strings"
+	"os"
+	"slices"
+	"time"
 )
 
-func InitConfig() {
-	InitFlags()
+const (
+	defaultServerHost      = "localhost"
+	defaultServerPort      = "8080"
+	defaultShutdownTimeout = 5 * time.Second
+	defaultLogLevel        = "info"
+	defaultTracing         = tracing.ExporterNone
+	defaultTokenTTL        = 60 * time.Minute
+	defaultDBMaxConns      = 10
+	defaultDBMaxLifetime   = time.Hour
+	defaultDBMaxIdleTime   = 30 * time.Minute
+	defaultDBHealthCheck   = time.Minute
+	defaultDBAttempts      = 10
+	defaultDBBackoff       = 500 * time.Millisecond
+	defaultDBMaxBackoff    = 10 * time.Second
+	defaultAccrualWorkers  = 2
+	defaultPollInterval    = time.Second
+	defaultCallbackSkew    = 5 * time.Minute
+	defaultIdempotencyTTL  = 24 * time.Hour
+	defaultTransferMin     = 1
+	defaultTransferMax     = 1000
+)
+
+// AppConfig is the full application configuration. Values are resolved with
+// the following precedence: flags > env > config file > defaults.
+type AppConfig struct {
+	Server     ServerConfig     `yaml:"server" toml:"server"`
+	DB         DBConfig         `yaml:"database" toml:"database"`
+	Accrual    AccrualConfig    `yaml:"accrual" toml:"accrual"`
+	JWT        JWTConfig        `yaml:"jwt" toml:"jwt"`
+	Log        LogConfig        `yaml:"log" toml:"log"`
+	Tracing    TracingConfig    `yaml:"tracing" toml:"tracing"`
+	RateLimit  RateLimitConfig  `yaml:"rate_limit" toml:"rate_limit"`
+	Workers    WorkersConfig    `yaml:"workers" toml:"workers"`
+	Expiration ExpirationConfig `yaml:"expiration" toml:"expiration"`
+	Transfers  TransfersConfig  `yaml:"transfers" toml:"transfers"`
+}
+
+type ServerConfig struct {
+	RunAddress      netAddr       `yaml:"run_address" toml:"run_address" env:"RUN_ADDRESS"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	// IdempotencyTTL is how long responses to requests carrying an
+	// Idempotency-Key header are kept for replay.
+	IdempotencyTTL time.Duration `yaml:"idempotency_ttl" toml:"idempotency_ttl" env:"IDEMPOTENCY_TTL"`
+}
+
+type DBConfig struct {
+	URI               database.DSN  `yaml:"uri" toml:"uri" env:"DATABASE_URI"`
+	MaxConns          int32         `yaml:"max_conns" toml:"max_conns" env:"DB_MAX_CONNS"`
+	MinConns          int32         `yaml:"min_conns" toml:"min_conns" env:"DB_MIN_CONNS"`
+	MinIdleConns      int32         `yaml:"min_idle_conns" toml:"min_idle_conns" env:"DB_MIN_IDLE_CONNS"`
+	MaxConnLifetime   time.Duration `yaml:"max_conn_lifetime" toml:"max_conn_lifetime" env:"DB_MAX_CONN_LIFETIME"`
+	MaxConnIdleTime   time.Duration `yaml:"max_conn_idle_time" toml:"max_conn_idle_time" env:"DB_MAX_CONN_IDLE_TIME"`
+	HealthCheckPeriod time.Duration `yaml:"health_check_period" toml:"health_check_period" env:"DB_HEALTH_CHECK_PERIOD"`
+	StatementTimeout  time.Duration `yaml:"statement_timeout" toml:"statement_timeout" env:"DB_STATEMENT_TIMEOUT"`
+	ConnectAttempts   int           `yaml:"connect_attempts" toml:"connect_attempts" env:"DB_CONNECT_ATTEMPTS"`
+	ConnectBackoff    time.Duration `yaml:"connect_backoff" toml:"connect_backoff" env:"DB_CONNECT_BACKOFF"`
+	ConnectMaxBackoff time.Duration `yaml:"connect_max_backoff" toml:"connect_max_backoff" env:"DB_CONNECT_MAX_BACKOFF"`
+	TLS               DBTLSConfig   `yaml:"tls" toml:"tls"`
+}
+
+// DBTLSConfig holds the libpq TLS parameters. When set they take precedence
+// over the same parameters given in the DSN.
+type DBTLSConfig struct {
+	Mode     string `yaml:"sslmode" toml:"sslmode" env:"DB_SSLMODE"`
+	RootCert string `yaml:"sslrootcert" toml:"sslrootcert" env:"DB_SSLROOTCERT"`
+	Cert     string `yaml:"sslcert" toml:"sslcert" env:"DB_SSLCERT"`
+	Key      string `yaml:"sslkey" toml:"sslkey" env:"DB_SSLKEY"`
+}
+
+var sslModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+// DSN returns the database DSN with the TLS settings applied.
+func (c *DBConfig) DSN() (database.DSN, error) {
+	return c.URI.WithParams(map[string]string{
+		"sslmode":     c.TLS.Mode,
+		"sslrootcert": c.TLS.RootCert,
+		"sslcert":     c.TLS.Cert,
+		"sslkey":      c.TLS.Key,
+	})
+}
+
+// Accrual update modes: poll asks the accrual system about pending orders,
+// push accepts results on the signed callback endpoint.
+const (
+	AccrualModePoll = "poll"
+	AccrualModePush = "push"
+	AccrualModeBoth = "both"
+)
+
+type AccrualConfig struct {
+	Mode             string        `yaml:"mode" toml:"mode" env:"ACCRUAL_MODE"`
+	Address          serviceURL    `yaml:"address" toml:"address" env:"ACCRUAL_SYSTEM_ADDRESS"`
+	Timeout          time.Duration `yaml:"timeout" toml:"timeout" env:"ACCRUAL_TIMEOUT"`
+	MaxRetries       int           `yaml:"max_retries" toml:"max_retries" env:"ACCRUAL_MAX_RETRIES"`
+	InitialBackoff   time.Duration `yaml:"initial_backoff" toml:"initial_backoff" env:"ACCRUAL_INITIAL_BACKOFF"`
+	MaxBackoff       time.Duration `yaml:"max_backoff" toml:"max_backoff" env:"ACCRUAL_MAX_BACKOFF"`
+	BreakerThreshold int           `yaml:"breaker_threshold" toml:"breaker_threshold" env:"ACCRUAL_BREAKER_THRESHOLD"`
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown" toml:"breaker_cooldown" env:"ACCRUAL_BREAKER_COOLDOWN"`
+	CallbackSecret   string        `yaml:"callback_secret" toml:"callback_secret" env:"ACCRUAL_CALLBACK_SECRET"`
+	CallbackMaxSkew  time.Duration `yaml:"callback_max_skew" toml:"callback_max_skew" env:"ACCRUAL_CALLBACK_MAX_SKEW"`
+}
+
+func (c *AccrualConfig) Polling() bool {
+	return c.Mode == AccrualModePoll || c.Mode == AccrualModeBoth
+}
+
+func (c *AccrualConfig) Pushing() bool {
+	return c.Mode == AccrualModePush || c.Mode == AccrualModeBoth
+}
+
+func (c *AccrualConfig) ClientConfig() accrual.Config {
+	return accrual.Config{
+		BaseURL:          c.Address.URL,
+		Timeout:          c.Timeout,
+		MaxRetries:       c.MaxRetries,
+		InitialBackoff:   c.InitialBackoff,
+		MaxBackoff:       c.MaxBackoff,
+		BreakerThreshold: c.BreakerThreshold,
+		BreakerCooldown:  c.BreakerCooldown,
+	}
+}
+
+type JWTConfig struct {
+	Secret   string        `yaml:"secret" toml:"secret" env:"SECRET"`
+	TokenTTL time.Duration `yaml:"token_ttl" toml:"token_ttl" env:"TOKEN_TTL"`
+}
 
-	err := ParseEnv()
+// ExpirationConfig makes credited points expire Months after crediting; 0
+// keeps them forever. Expired points are written off every Interval.
+type ExpirationConfig struct {
+	Months   int           `yaml:"months" toml:"months" env:"POINTS_EXPIRE_MONTHS"`
+	Interval time.Duration `yaml:"interval" toml:"interval" env:"POINTS_EXPIRATION_INTERVAL"`
+}
+
+func (c *ExpirationConfig) Policy() models.ExpiryPolicy {
+	return models.ExpiryPolicy{Months: c.Months}
+}
+
+// TransfersConfig limits point transfers between users. A zero DailyMax
+// disables the daily limit.
+type TransfersConfig struct {
+	MinAmount float64 `yaml:"min_amount" toml:"min_amount" env:"TRANSFER_MIN_AMOUNT"`
+	DailyMax  float64 `yaml:"daily_max" toml:"daily_max" env:"TRANSFER_DAILY_MAX"`
+}
+
+func (c *TransfersConfig) Limits() service.TransferLimits {
+	return service.TransferLimits{MinAmount: c.MinAmount, DailyMax: c.DailyMax}
+}
+
+type LogConfig struct {
+	Level string `yaml:"level" toml:"level" env:"LOG_LEVEL"`
+}
+
+type TracingConfig struct {
+	Exporter string `yaml:"exporter" toml:"exporter" env:"TRACING_EXPORTER"`
+	Endpoint string `yaml:"endpoint" toml:"endpoint" env:"TRACING_ENDPOINT"`
+}
+
+type RateLimitConfig struct {
+	PublicRate     float64 `yaml:"public_rate" toml:"public_rate" env:"RATE_LIMIT_PUBLIC_RATE"`
+	PublicBurst    int     `yaml:"public_burst" toml:"public_burst" env:"RATE_LIMIT_PUBLIC_BURST"`
+	UserRate       float64 `yaml:"user_rate" toml:"user_rate" env:"RATE_LIMIT_USER_RATE"`
+	UserBurst      int     `yaml:"user_burst" toml:"user_burst" env:"RATE_LIMIT_USER_BURST"`
+	AuthRate       float64 `yaml:"auth_rate" toml:"auth_rate" env:"RATE_LIMIT_AUTH_RATE"`
+	AuthBurst      int     `yaml:"auth_burst" toml:"auth_burst" env:"RATE_LIMIT_AUTH_BURST"`
+	TrustedProxies string  `yaml:"trusted_proxies" toml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+}
 
+type WorkersConfig struct {
+	AccrualWorkers  int           `yaml:"accrual_workers" toml:"accrual_workers" env:"ACCRUAL_WORKERS"`
+	PollInterval    time.Duration `yaml:"poll_interval" toml:"poll_interval" env:"ACCRUAL_POLL_INTERVAL"`
+	BatchSize       int           `yaml:"batch_size" toml:"batch_size" env:"ACCRUAL_BATCH_SIZE"`
+	LeaseTimeout    time.Duration `yaml:"lease_timeout" toml:"lease_timeout" env:"ACCRUAL_LEASE_TIMEOUT"`
+	MaxAttempts     int           `yaml:"max_attempts" toml:"max_attempts" env:"ACCRUAL_MAX_ATTEMPTS"`
+	RetryBackoff    time.Duration `yaml:"retry_backoff" toml:"retry_backoff" env:"ACCRUAL_RETRY_BACKOFF"`
+	RetryMaxBackoff time.Duration `yaml:"retry_max_backoff" toml:"retry_max_backoff" env:"ACCRUAL_RETRY_MAX_BACKOFF"`
+}
+
+func (c *WorkersConfig) PollerConfig() workers.AccrualPollerConfig {
+	return workers.AccrualPollerConfig{
+		Interval:        c.PollInterval,
+		Workers:         c.AccrualWorkers,
+		BatchSize:       c.BatchSize,
+		LeaseTimeout:    c.LeaseTimeout,
+		MaxAttempts:     c.MaxAttempts,
+		RetryBackoff:    c.RetryBackoff,
+		RetryMaxBackoff: c.RetryMaxBackoff,
+	}
+}
+
+var Config = DefaultConfig()
+
+func DefaultConfig() AppConfig {
+	return AppConfig{
+		Server: ServerConfig{
+			RunAddress:      netAddr{Host: defaultServerHost, Port: defaultServerPort},
+			ShutdownTimeout: defaultShutdownTimeout,
+			IdempotencyTTL:  defaultIdempotencyTTL,
+		},
+		DB: DBConfig{
+			MaxConns:          defaultDBMaxConns,
+			MaxConnLifetime:   defaultDBMaxLifetime,
+			MaxConnIdleTime:   defaultDBMaxIdleTime,
+			HealthCheckPeriod: defaultDBHealthCheck,
+			ConnectAttempts:   defaultDBAttempts,
+			ConnectBackoff:    defaultDBBackoff,
+			ConnectMaxBackoff: defaultDBMaxBackoff,
+		},
+		Accrual: AccrualConfig{
+			Mode:             AccrualModePoll,
+			CallbackMaxSkew:  defaultCallbackSkew,
+			Timeout:          accrual.DefaultTimeout,
+			MaxRetries:       accrual.DefaultMaxRetries,
+			InitialBackoff:   accrual.DefaultInitialBackoff,
+			MaxBackoff:       accrual.DefaultMaxBackoff,
+			BreakerThreshold: accrual.DefaultBreakerThreshold,
+			BreakerCooldown:  accrual.DefaultBreakerCooldown,
+		},
+		JWT:     JWTConfig{TokenTTL: defaultTokenTTL},
+		Log:     LogConfig{Level: defaultLogLevel},
+		Tracing: TracingConfig{Exporter: defaultTracing},
+		Workers: WorkersConfig{
+			AccrualWorkers:  defaultAccrualWorkers,
+			PollInterval:    defaultPollInterval,
+			BatchSize:       workers.DefaultBatchSize,
+			LeaseTimeout:    workers.DefaultLeaseTimeout,
+			MaxAttempts:     workers.DefaultMaxAttempts,
+			RetryBackoff:    workers.DefaultRetryBackoff,
+			RetryMaxBackoff: workers.DefaultRetryMaxBackoff,
+		},
+		Expiration: ExpirationConfig{Interval: workers.DefaultExpirationInterval},
+		Transfers:  TransfersConfig{MinAmount: defaultTransferMin, DailyMax: defaultTransferMax},
+	}
+}
+
+// LoadConfig resolves the configuration from defaults, the config file given
+// by -c or CONFIG, the environment and the command line args.
+func LoadConfig(args []string) (AppConfig, error) {
+	configPath, err := lookupConfigPath(args)
 	if err != nil {
-		log.Fatal("unable parse ENV:", err)
+		return AppConfig{}, err
 	}
 
-	if Env.RunAddress != "" {
-		host, port, err := net.SplitHostPort(Env.RunAddress)
-		if err != nil {
-			log.Fatal("invalid RUN_ADDRESS environment variable: ", Env.RunAddress)
+	cfg := DefaultConfig()
+	if configPath != "" {
+		if err := LoadFile(configPath, &cfg); err != nil {
+			return AppConfig{}, err
 		}
-		Config.RunAddress.Host = host
-		Config.RunAddress.Port = port
 	}
 
-	if Env.AccrualAddress != "" {
-		splitedAddr := strings.Split(Env.AccrualAddress, "://")
-		host, port, err := net.SplitHostPort(splitedAddr[1])
-		if err != nil {
-			log.Fatal("invalid ACCRUAL_SYSTEM_ADDRESS environment variable: ", Env.AccrualAddress)
-		}
-		Config.AccrualAddress.Host = host
-		Config.AccrualAddress.Port = port
+	if err := ParseEnv(&cfg); err != nil {
+		return AppConfig{}, err
 	}
 
-	if Env.LogLevel != "" {
-		Config.LogLevel = Env.LogLevel
+	fs, _ := newFlagSet(&cfg)
+	if err := fs.Parse(args); err != nil {
+		return AppConfig{}, err
 	}
 
-	if Env.DatabaseURI != "" {
-		err := Config.DB.Set(Env.DatabaseURI)
-		if err != nil {
-			log.Fatal("unable to parse DATABASE_URI environment variable: ", Env.DatabaseURI)
-		}
+	return cfg, nil
+}
+
+// Validate reports every problem found in the configuration at once.
+func (c *AppConfig) Validate() error {
+	var errs []error
+
+	if c.Server.RunAddress.Port == "" {
+		errs = append(errs, errors.New("server.run_address: port is required"))
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("server.shutdown_timeout: must be positive"))
+	}
+	if c.Server.IdempotencyTTL <= 0 {
+		errs = append(errs, errors.New("server.idempotency_ttl: must be positive"))
+	}
+
+	if c.DB.URI.IsZero() {
+		errs = append(errs, errors.New("database.uri: is empty, set it using config file, DATABASE_URI or CLI flag '-d'"))
+	} else if _, err := c.DB.DSN(); err != nil {
+		errs = append(errs, fmt.Errorf("database: %w", err))
+	}
+	if c.DB.TLS.Mode != "" && !slices.Contains(sslModes, c.DB.TLS.Mode) {
+		errs = append(errs, fmt.Errorf("database.tls.sslmode: must be one of %v", sslModes))
+	}
+	if c.DB.MaxConns < 1 {
+		errs = append(errs, errors.New("database.max_conns: must be at least 1"))
+	}
+	if c.DB.MinConns < 0 || c.DB.MinConns > c.DB.MaxConns {
+		errs = append(errs, fmt.Errorf("database.min_conns: must be between 0 and max_conns (%d)", c.DB.MaxConns))
+	}
+	if c.DB.MinIdleConns < 0 || c.DB.MinIdleConns > c.DB.MaxConns {
+		errs = append(errs, fmt.Errorf("database.min_idle_conns: must be between 0 and max_conns (%d)", c.DB.MaxConns))
+	}
+	if c.DB.MaxConnLifetime <= 0 || c.DB.HealthCheckPeriod <= 0 {
+		errs = append(errs, errors.New("database: max_conn_lifetime and health_check_period must be positive"))
+	}
+	if c.DB.StatementTimeout < 0 {
+		errs = append(errs, errors.New("database.statement_timeout: must not be negative"))
+	}
+	if c.DB.ConnectAttempts < 1 {
+		errs = append(errs, errors.New("database.connect_attempts: must be at least 1"))
+	}
+	if c.DB.ConnectBackoff <= 0 || c.DB.ConnectMaxBackoff < c.DB.ConnectBackoff {
+		errs = append(errs, errors.New("database: connect_backoff must be positive and not greater than connect_max_backoff"))
+	}
+
+	switch c.Accrual.Mode {
+	case AccrualModePoll, AccrualModePush, AccrualModeBoth:
+	default:
+		errs = append(errs, fmt.Errorf("accrual.mode: must be one of %s, %s or %s", AccrualModePoll, AccrualModePush, AccrualModeBoth))
+	}
+	if c.Accrual.Pushing() && c.Accrual.CallbackSecret == "" {
+		errs = append(errs, errors.New("accrual.callback_secret: is required in push mode"))
+	}
+	if c.Accrual.CallbackMaxSkew <= 0 {
+		errs = append(errs, errors.New("accrual.callback_max_skew: must be positive"))
+	}
+	if c.Accrual.Timeout <= 0 {
+		errs = append(errs, errors.New("accrual.timeout: must be positive"))
+	}
+	if c.Accrual.MaxRetries < 0 || c.Accrual.BreakerThreshold < 0 {
+		errs = append(errs, errors.New("accrual: max_retries and breaker_threshold must not be negative"))
+	}
+	if c.Accrual.InitialBackoff <= 0 || c.Accrual.MaxBackoff < c.Accrual.InitialBackoff {
+		errs = append(errs, errors.New("accrual: initial_backoff must be positive and not greater than max_backoff"))
+	}
+
+	if c.JWT.Secret == "" {
+		errs = append(errs, errors.New("jwt.secret: is empty, set it using config file or SECRET"))
+	}
+	if c.JWT.TokenTTL <= 0 {
+		errs = append(errs, errors.New("jwt.token_ttl: must be positive"))
+	}
+
+	if _, err := zap.ParseAtomicLevel(c.Log.Level); err != nil {
+		errs = append(errs, fmt.Errorf("log.level: %w", err))
+	}
+
+	switch c.Tracing.Exporter {
+	case tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP:
+	default:
+		errs = append(errs, fmt.Errorf("tracing.exporter: %w: %q", tracing.ErrUnknownExporter, c.Tracing.Exporter))
+	}
+
+	if c.RateLimit.PublicRate < 0 || c.RateLimit.UserRate < 0 || c.RateLimit.AuthRate < 0 {
+		errs = append(errs, errors.New("rate_limit: rates must not be negative"))
+	}
+	if _, err := middlewares.ParseTrustedProxies(c.RateLimit.TrustedProxies); err != nil {
+		errs = append(errs, fmt.Errorf("rate_limit.trusted_proxies: %w", err))
+	}
+
+	if c.Workers.AccrualWorkers < 1 {
+		errs = append(errs, errors.New("workers.accrual_workers: must be at least 1"))
+	}
+	if c.Workers.PollInterval <= 0 {
+		errs = append(errs, errors.New("workers.poll_interval: must be positive"))
+	}
+	if c.Workers.BatchSize < 1 {
+		errs = append(errs, errors.New("workers.batch_size: must be at least 1"))
+	}
+	if c.Workers.LeaseTimeout <= 0 {
+		errs = append(errs, errors.New("workers.lease_timeout: must be positive"))
+	}
+	if c.Workers.MaxAttempts < 1 {
+		errs = append(errs, errors.New("workers.max_attempts: must be at least 1"))
+	}
+	if c.Workers.RetryBackoff <= 0 || c.Workers.RetryMaxBackoff < c.Workers.RetryBackoff {
+		errs = append(errs, errors.New("workers.retry_backoff: must be positive and not exceed retry_max_backoff"))
+	}
+
+	if c.Expiration.Months < 0 {
+		errs = append(errs, errors.New("expiration.months: must not be negative"))
+	}
+	if c.Expiration.Interval <= 0 {
+		errs = append(errs, errors.New("expiration.interval: must be positive"))
+	}
+
+	if c.Transfers.MinAmount < 0 || c.Transfers.DailyMax < 0 {
+		errs = append(errs, errors.New("transfers: min_amount and daily_max must not be negative"))
 	}
 
-	dbURI := Config.DB.String()
-	Config.DB.URI = dbURI
+	return errors.Join(errs...)
+}
 
-	err = logger.Initialize(Config.LogLevel)
+func InitConfig() {
+	cfg, err := LoadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatal("unable to load config: ", err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("invalid config:\n%v", err)
+	}
+	Config = cfg
+
+	err = logger.Initialize(Config.Log.Level)
 	if err != nil {
 		log.Fatal("unable to initialize logger:", err)
 	}
@@ -62,17 +429,15 @@ func InitConfig() {
 		"\033[1;36m│ \033[1;33m🐘 Database DSN:     \033[0;37m%-39s\033[0m\n" +
 		"\033[1;36m│ \033[1;33m◉  Accrual Address:  \033[0;37m%-39s\033[0m\n" +
 		"\033[1;36m│ \033[1;33m📝 Logging Level:    \033[0;37m%-39s\033[0m\n" +
+		"\033[1;36m│ \033[1;33m🔭 Tracing:          \033[0;37m%-39s\033[0m\n" +
 		"\033[1;36m╰────────────────────────────────────────\033[0m\n"
 
 	fmt.Printf(
 		initMessage,
-		Config.RunAddress.String(),
-		Config.DB.URI,
-		Config.AccrualAddress.String(),
-		Config.LogLevel,
+		Config.Server.RunAddress.String(),
+		Config.DB.URI.Redacted(),
+		Config.Accrual.Address.String(),
+		Config.Log.Level,
+		Config.Tracing.Exporter,
 	)
-
-	if dbURI == "" {
-		log.Fatal("DATABASE_URI is empty, please set it using ENV or CLI flag '-d'")
-	}
 }
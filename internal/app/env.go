@@ -5,18 +5,10 @@ import (
 	"log"
 )
 
-type envParams struct {
-	RunAddress     string `env:"RUN_ADDRESS"`
-	LogLevel       string `env:"LOG_LEVEL"`
-	DatabaseURI    string `env:"DATABASE_URI"`
-	AccrualAddress string `env:"ACCRUAL_SYSTEM_ADDRESS"`
-	Secret         string `env:"SECRET"`
-}
-
-var Env envParams
-
-func ParseEnv() error {
-	err := env.Parse(&Env)
+// ParseEnv overrides cfg with the environment variables named in its `env` tags.
+// Fields whose variables are unset keep their current values.
+func ParseEnv(cfg *AppConfig) error {
+	err := env.Parse(cfg)
 
 	if err != nil {
 		log.Println("Unable to parse ENV:", err)
@@ -0,0 +1,45 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrUnsupportedConfigFormat = errors.New("unsupported config file format, use .yaml, .yml or .toml")
+
+// LoadFile reads the YAML or TOML file at path into cfg, chosen by extension.
+// Unknown keys are rejected so that typos do not go unnoticed.
+func LoadFile(path string, cfg *AppConfig) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("%s: unknown keys %v", path, undecoded)
+		}
+	default:
+		return fmt.Errorf("%s: %w", path, ErrUnsupportedConfigFormat)
+	}
+
+	return nil
+}
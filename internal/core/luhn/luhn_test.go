@@ -0,0 +1,29 @@
+package luhn
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		number string
+		valid  bool
+	}{
+		{"12345678903", true},
+		{"9278923470", true},
+		{"2377225624", true},
+		{"346436439", true},
+		{"0", true},
+		{"12345678904", false},
+		{"", false},
+		{"1234-5678", false},
+		{" 12345678903", false},
+	}
+
+	for _, test := range tests {
+		t.Run("test number:"+test.number, func(t *testing.T) {
+			assert.Equal(t, test.valid, Valid(test.number))
+		})
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"errors"
 	"fmt"
 	"github.com/golang-jwt/jwt/v4"
-	"github.com/rshafikov/gophermart/internal/app"
 	"github.com/rshafikov/gophermart/internal/core/logger"
 	"go.uber.org/zap"
 	"strings"
@@ -25,29 +24,41 @@ type JWTToken struct {
 
 type TokenPayload struct {
 	jwt.RegisteredClaims
+	Role string `json:"role,omitempty"`
 }
 
 type JWTHandler interface {
-	GenerateJWT(login string) (*JWTToken, error)
+	GenerateJWT(login, role string) (*JWTToken, error)
 	ParseJWT(tokenString string) (*TokenPayload, error)
 }
 
-type jwtHandler struct{}
+type jwtHandler struct {
+	secret   []byte
+	tokenTTL time.Duration
+}
 
-func NewJWTHandler() JWTHandler {
-	return &jwtHandler{}
+// NewJWTHandler returns a handler signing tokens with secret. A non-positive
+// tokenTTL falls back to TokenExpTime.
+func NewJWTHandler(secret string, tokenTTL time.Duration) JWTHandler {
+	if tokenTTL <= 0 {
+		tokenTTL = TokenExpTime
+	}
+	return &jwtHandler{secret: []byte(secret), tokenTTL: tokenTTL}
 }
 
-func (j *jwtHandler) GenerateJWT(login string) (*JWTToken, error) {
-	expires := jwt.NewNumericDate(time.Now().Add(TokenExpTime))
+func (j *jwtHandler) GenerateJWT(login, role string) (*JWTToken, error) {
+	now := time.Now()
+	expires := jwt.NewNumericDate(now.Add(j.tokenTTL))
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, TokenPayload{
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: expires,
+			IssuedAt:  jwt.NewNumericDate(now),
 			Subject:   login,
 		},
+		Role: role,
 	})
 
-	tokenString, err := token.SignedString([]byte(app.Env.Secret))
+	tokenString, err := token.SignedString(j.secret)
 	if err != nil {
 		return nil, err
 	}
@@ -62,7 +73,7 @@ func (j *jwtHandler) ParseJWT(tokenString string) (*TokenPayload, error) {
 			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
 				return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
 			}
-			return []byte(app.Env.Secret), nil
+			return j.secret, nil
 		})
 
 	if err != nil {
@@ -80,8 +91,14 @@ func (j *jwtHandler) ParseJWT(tokenString string) (*TokenPayload, error) {
 
 type MockJWTHandler struct{}
 
-func (m *MockJWTHandler) GenerateJWT(login string) (*JWTToken, error) {
-	return &JWTToken{Token: "fake-token " + login, TokenType: TokenType}, nil
+// GenerateJWT returns "fake-token <login>", followed by ":<role>" unless
+// the role is the default one.
+func (m *MockJWTHandler) GenerateJWT(login, role string) (*JWTToken, error) {
+	token := "fake-token " + login
+	if role != "" && role != "user" {
+		token += ":" + role
+	}
+	return &JWTToken{Token: token, TokenType: TokenType}, nil
 }
 
 func (m *MockJWTHandler) ParseJWT(token string) (*TokenPayload, error) {
@@ -90,5 +107,6 @@ func (m *MockJWTHandler) ParseJWT(token string) (*TokenPayload, error) {
 		return nil, ErrTokenInvalid
 	}
 
-	return &TokenPayload{jwt.RegisteredClaims{Subject: splitedToken[1]}}, nil
+	login, role, _ := strings.Cut(splitedToken[1], ":")
+	return &TokenPayload{RegisteredClaims: jwt.RegisteredClaims{Subject: login}, Role: role}, nil
 }
@@ -2,12 +2,16 @@ package security
 
 import (
 	"regexp"
+	"strings"
 )
 
+// DeletedLoginPrefix is reserved for the logins of deleted accounts.
+const DeletedLoginPrefix = "deleted-"
+
 var LoginRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]{0,18}[a-zA-Z0-9]$`)
 
 func IsLoginValid(login string) bool {
-	if len(login) < 3 || len(login) > 20 {
+	if len(login) < 3 || len(login) > 20 || strings.HasPrefix(login, DeletedLoginPrefix) {
 		return false
 	}
 	return LoginRegex.MatchString(login)
@@ -18,6 +18,8 @@ func TestIsLoginValid(t *testing.T) {
 		{"_user", false},
 		{"user_", false},
 		{"toolongusername123456", false},
+		{"deleted-user", false},
+		{"deleted_user", true},
 	}
 
 	for _, test := range tests {
@@ -0,0 +1,93 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddleware_SpanNamedAfterRoute(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/api/user/orders/{number}", func(w http.ResponseWriter, r *http.Request) {})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/user/orders/12345678903", nil)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "GET /api/user/orders/{number}", spans[0].Name())
+}
+
+func TestNewTransport_PropagatesTraceContext(t *testing.T) {
+	otel.SetTracerProvider(sdktrace.NewTracerProvider())
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var traceparent string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+	}))
+	defer ts.Close()
+
+	ctx, span := Start(context.Background(), "test")
+	defer span.End()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL, nil)
+	require.NoError(t, err)
+
+	client := &http.Client{Transport: NewTransport(nil)}
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Contains(t, traceparent, span.SpanContext().TraceID().String())
+}
+
+func TestNewExporter(t *testing.T) {
+	tests := []struct {
+		name     string
+		exporter string
+		wantErr  error
+	}{
+		{name: "stdout", exporter: ExporterStdout},
+		{name: "otlp", exporter: ExporterOTLP},
+		{name: "unknown", exporter: "zipkin", wantErr: ErrUnknownExporter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exp, err := newExporter(context.Background(), tt.exporter, "", &bytes.Buffer{})
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotNil(t, exp)
+		})
+	}
+}
+
+func TestStdoutExporterWritesSpans(t *testing.T) {
+	var buf bytes.Buffer
+	exp, err := newExporter(context.Background(), ExporterStdout, "", &buf)
+	require.NoError(t, err)
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+	_, span := provider.Tracer(ServiceName).Start(context.Background(), "UserService.Register")
+	span.End()
+	require.NoError(t, provider.Shutdown(context.Background()))
+
+	assert.Contains(t, buf.String(), "UserService.Register")
+}
@@ -1,8 +1,13 @@
 package database
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rshafikov/gophermart/internal/core/logger"
+	"go.uber.org/zap"
+	"time"
 )
 
 var ErrDB = errors.New("internal database error")
@@ -11,3 +16,53 @@ var ErrConnectDB = errors.New("unable to connect to database")
 type DB struct {
 	Pool *pgxpool.Pool
 }
+
+func (db *DB) Close() {
+	if db.Pool != nil {
+		db.Pool.Close()
+	}
+}
+
+// RetryPolicy describes how long to wait for the database at boot. The delay
+// between attempts doubles from InitialBackoff up to MaxBackoff.
+type RetryPolicy struct {
+	Attempts       int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// WaitForDB pings the pool until it answers, retrying according to policy.
+// It returns ErrConnectDB wrapping the last error once attempts are exhausted.
+func WaitForDB(ctx context.Context, pool *pgxpool.Pool, policy RetryPolicy) error {
+	attempts := max(policy.Attempts, 1)
+	backoff := policy.InitialBackoff
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = pool.Ping(ctx); err == nil {
+			return nil
+		}
+		if attempt >= attempts {
+			break
+		}
+
+		logger.L.Warn("database is not ready, retrying",
+			zap.Int("attempt", attempt),
+			zap.Duration("backoff", backoff),
+			zap.Error(err),
+		)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", ErrConnectDB, ctx.Err())
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if policy.MaxBackoff > 0 && backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+
+	return fmt.Errorf("%w: %w", ErrConnectDB, err)
+}
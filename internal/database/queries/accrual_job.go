@@ -0,0 +1,62 @@
+package queries
+
+const EnqueueAccrualJob = `
+	INSERT INTO accrual_jobs (order_number) VALUES ($1)
+	ON CONFLICT (order_number) DO UPDATE
+	SET status = 'PENDING', attempts = 0, next_run_at = CURRENT_TIMESTAMP,
+		locked_until = NULL, last_error = NULL, updated_at = CURRENT_TIMESTAMP;
+`
+
+// LeaseAccrualJobs takes up to $1 due jobs for $2 seconds. SKIP LOCKED lets
+// concurrent replicas lease disjoint batches; jobs whose lease has expired
+// are due again.
+const LeaseAccrualJobs = `
+	WITH due AS (
+		SELECT order_number FROM accrual_jobs
+		WHERE status = 'PENDING'
+		  AND next_run_at <= CURRENT_TIMESTAMP
+		  AND (locked_until IS NULL OR locked_until <= CURRENT_TIMESTAMP)
+		ORDER BY next_run_at
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	)
+	UPDATE accrual_jobs j
+	SET attempts = j.attempts + 1,
+		locked_until = CURRENT_TIMESTAMP + make_interval(secs => $2),
+		updated_at = CURRENT_TIMESTAMP
+	FROM due WHERE j.order_number = due.order_number
+	RETURNING j.order_number, j.status, j.attempts, j.next_run_at, j.locked_until, j.last_error;
+`
+
+// The queries below only touch a job still held by the caller's lease:
+// locked_until acts as the fencing token.
+
+const CompleteAccrualJob = `
+	UPDATE accrual_jobs
+	SET status = 'DONE', locked_until = NULL, last_error = NULL, updated_at = CURRENT_TIMESTAMP
+	WHERE order_number = $1 AND locked_until = $2;
+`
+
+const RescheduleAccrualJob = `
+	UPDATE accrual_jobs
+	SET attempts = 0, next_run_at = $3, locked_until = NULL, last_error = NULL, updated_at = CURRENT_TIMESTAMP
+	WHERE order_number = $1 AND locked_until = $2;
+`
+
+const ReleaseAccrualJob = `
+	UPDATE accrual_jobs
+	SET attempts = GREATEST(attempts - 1, 0), next_run_at = $3, locked_until = NULL, updated_at = CURRENT_TIMESTAMP
+	WHERE order_number = $1 AND locked_until = $2;
+`
+
+const RetryAccrualJob = `
+	UPDATE accrual_jobs
+	SET next_run_at = $3, locked_until = NULL, last_error = $4, updated_at = CURRENT_TIMESTAMP
+	WHERE order_number = $1 AND locked_until = $2;
+`
+
+const BuryAccrualJob = `
+	UPDATE accrual_jobs
+	SET status = 'DEAD', locked_until = NULL, last_error = $3, updated_at = CURRENT_TIMESTAMP
+	WHERE order_number = $1 AND locked_until = $2;
+`
@@ -0,0 +1,23 @@
+package queries
+
+const CreateAuditEntry = `
+	INSERT INTO audit_log (actor_id, user_id, action, reason, details)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at;
+`
+
+// ListAuditLog pages like ListOrdersByUser; $1 and $2 optionally filter by
+// actor and user.
+const ListAuditLog = `
+	SELECT a.id, a.actor_id, actor.login, a.user_id, u.login, a.action, a.reason, a.details, a.created_at
+	FROM audit_log a
+	JOIN users actor ON actor.id = a.actor_id
+	JOIN users u ON u.id = a.user_id
+	WHERE ($1::int IS NULL OR a.actor_id = $1)
+	  AND ($2::int IS NULL OR a.user_id = $2)
+	  AND ($3::timestamptz IS NULL OR (a.created_at, a.id) < ($3, $4))
+	  AND ($5::timestamptz IS NULL OR a.created_at >= $5)
+	  AND ($6::timestamptz IS NULL OR a.created_at < $6)
+	ORDER BY a.created_at DESC, a.id DESC
+	LIMIT $7;
+`
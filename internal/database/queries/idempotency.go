@@ -0,0 +1,38 @@
+package queries
+
+// ReserveIdempotencyKey leases the key for $5 seconds. It returns no row
+// when a live record exists for the key; an expired one, or one whose request
+// never completed within its lease, is replaced.
+const ReserveIdempotencyKey = `
+	INSERT INTO idempotency_keys (user_id, key, request_hash, expires_at, locked_until)
+	VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP + make_interval(secs => $5))
+	ON CONFLICT (user_id, key) DO UPDATE
+	SET request_hash = EXCLUDED.request_hash, status_code = NULL, content_type = NULL, body = NULL,
+		created_at = CURRENT_TIMESTAMP, expires_at = EXCLUDED.expires_at, locked_until = EXCLUDED.locked_until
+	WHERE idempotency_keys.expires_at <= CURRENT_TIMESTAMP
+	   OR (idempotency_keys.status_code IS NULL
+		   AND (idempotency_keys.locked_until IS NULL OR idempotency_keys.locked_until <= CURRENT_TIMESTAMP))
+	RETURNING locked_until;
+`
+
+const GetIdempotencyKey = `
+	SELECT user_id, key, request_hash, COALESCE(status_code, 0), COALESCE(content_type, ''), body, expires_at
+	FROM idempotency_keys
+	WHERE user_id = $1 AND key = $2 AND expires_at > CURRENT_TIMESTAMP;
+`
+
+// The queries below only touch a record still held by the caller's lease:
+// locked_until acts as the fencing token.
+
+const CompleteIdempotencyKey = `
+	UPDATE idempotency_keys SET status_code = $4, content_type = $5, body = $6, locked_until = NULL
+	WHERE user_id = $1 AND key = $2 AND locked_until = $3;
+`
+
+const DeleteIdempotencyKey = `
+	DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2 AND locked_until = $3;
+`
+
+const DeleteExpiredIdempotencyKeys = `
+	DELETE FROM idempotency_keys WHERE expires_at <= CURRENT_TIMESTAMP;
+`
@@ -0,0 +1,72 @@
+package queries
+
+// CreditOrderAccrual does nothing if the order has already been credited.
+const CreditOrderAccrual = `
+	INSERT INTO ledger_entries (user_id, kind, amount, order_number)
+	VALUES ($1, 'ACCRUAL', $2, $3)
+	ON CONFLICT (order_number) WHERE kind = 'ACCRUAL' DO NOTHING;
+`
+
+const GetBalance = `
+	SELECT
+		COALESCE(SUM(amount), 0),
+		COALESCE(-SUM(amount) FILTER (WHERE kind IN ('WITHDRAWAL', 'REFUND')), 0)
+	FROM ledger_entries WHERE user_id = $1;
+`
+
+const ListLedgerEntries = `
+	SELECT id, user_id, kind, amount, order_number, transfer_id, created_at
+	FROM ledger_entries
+	WHERE user_id = $1
+	ORDER BY created_at, id;
+`
+
+// ListUsersWithExpiredCredits finds the users with a positive balance and a
+// credit made before $1 that was still valid, for $2 months, when their
+// latest expiration was written off. Users whose expired credits have all
+// been written off are skipped. The validity is padded by a few days because
+// Postgres and Go add months differently at the end of a month.
+const ListUsersWithExpiredCredits = `
+	SELECT c.user_id
+	FROM ledger_entries c
+	WHERE c.amount > 0 AND c.created_at < $1
+	  AND c.created_at + make_interval(months => $2, days => 3) > COALESCE((
+		SELECT MAX(x.created_at) FROM ledger_entries x
+		WHERE x.user_id = c.user_id AND x.kind = 'EXPIRATION'
+	  ), '-infinity')
+	GROUP BY c.user_id
+	HAVING (SELECT SUM(b.amount) FROM ledger_entries b WHERE b.user_id = c.user_id) > 0;
+`
+
+const CreateExpiration = `
+	INSERT INTO ledger_entries (user_id, kind, amount, created_at)
+	VALUES ($1, 'EXPIRATION', -$2::numeric, $3);
+`
+
+// ListTransactions pages the user's ledger entries like ListOrdersByUser,
+// with the kind filter in $2. The running balance is computed over all
+// entries before the page is cut. Transfers carry the other user's login.
+const ListTransactions = `
+	SELECT e.id, e.user_id, e.kind, e.amount, e.order_number, e.transfer_id, COALESCE(e.reason, ''), e.created_at, e.balance,
+		CASE e.kind WHEN 'TRANSFER_OUT' THEN r.login WHEN 'TRANSFER_IN' THEN s.login END
+	FROM (
+		SELECT *, SUM(amount) OVER (ORDER BY created_at, id) AS balance
+		FROM ledger_entries
+		WHERE user_id = $1
+	) e
+	LEFT JOIN transfers t ON t.id = e.transfer_id
+	LEFT JOIN users s ON s.id = t.sender_id
+	LEFT JOIN users r ON r.id = t.recipient_id
+	WHERE ($2::text[] IS NULL OR e.kind = ANY ($2))
+	  AND ($3::timestamptz IS NULL OR (e.created_at, e.id) < ($3, $4))
+	  AND ($5::timestamptz IS NULL OR e.created_at >= $5)
+	  AND ($6::timestamptz IS NULL OR e.created_at < $6)
+	ORDER BY e.created_at DESC, e.id DESC
+	LIMIT $7;
+`
+
+const CreateAdjustment = `
+	INSERT INTO ledger_entries (user_id, kind, amount, reason)
+	VALUES ($1, 'ADJUSTMENT', $2, $3)
+	RETURNING id, created_at;
+`
@@ -0,0 +1,81 @@
+package queries
+
+// CreateOrder inserts the order, its first event and its accrual check in
+// the same statement.
+const CreateOrder = `
+	WITH o AS (
+		INSERT INTO orders (number, user_id, status)
+		VALUES ($1, $2, $3)
+		RETURNING id, number, status, uploaded_at, updated_at
+	), e AS (
+		INSERT INTO order_events (order_id, to_status, source, created_at)
+		SELECT id, status, $4, uploaded_at FROM o
+	), j AS (
+		INSERT INTO accrual_jobs (order_number) SELECT number FROM o
+	)
+	SELECT id, uploaded_at, updated_at FROM o;
+`
+
+// CreateOrderIfAbsent is CreateOrder that returns no row, instead of
+// failing, for an existing number, so it can be batched.
+const CreateOrderIfAbsent = `
+	WITH o AS (
+		INSERT INTO orders (number, user_id, status)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (number) DO NOTHING
+		RETURNING id, number, status, uploaded_at, updated_at
+	), e AS (
+		INSERT INTO order_events (order_id, to_status, source, created_at)
+		SELECT id, status, $4, uploaded_at FROM o
+	), j AS (
+		INSERT INTO accrual_jobs (order_number) SELECT number FROM o
+	)
+	SELECT id, uploaded_at, updated_at FROM o;
+`
+
+const GetOrderOwners = `
+	SELECT number, user_id FROM orders WHERE number = ANY ($1);
+`
+
+const GetOrderByNumber = `
+	SELECT id, number, user_id, status, accrual, uploaded_at, updated_at
+	FROM orders WHERE number = $1;
+`
+
+// ListOrdersByUser pages by (uploaded_at, id) after the cursor in $3, $4.
+// NULL parameters disable their filter, a NULL limit returns all rows.
+const ListOrdersByUser = `
+	SELECT id, number, user_id, status, accrual, uploaded_at, updated_at
+	FROM orders
+	WHERE user_id = $1
+	  AND ($2::text[] IS NULL OR status = ANY ($2))
+	  AND ($3::timestamptz IS NULL OR (uploaded_at, id) < ($3, $4))
+	  AND ($5::timestamptz IS NULL OR uploaded_at >= $5)
+	  AND ($6::timestamptz IS NULL OR uploaded_at < $6)
+	ORDER BY uploaded_at DESC, id DESC
+	LIMIT $7;
+`
+
+// UpdateOrderStatus changes the status only if it is still $2, records the
+// event and returns the owner; no row is returned otherwise.
+const UpdateOrderStatus = `
+	WITH o AS (
+		UPDATE orders SET status = $3, accrual = $4, updated_at = CURRENT_TIMESTAMP
+		WHERE number = $1 AND status = $2
+		RETURNING id, user_id, status, accrual, updated_at
+	), e AS (
+		INSERT INTO order_events (order_id, from_status, to_status, accrual, source, created_at)
+		SELECT id, $2, status, accrual, $5, updated_at FROM o
+	)
+	SELECT user_id FROM o;
+`
+
+const ListOrderEvents = `
+	SELECT id, order_id, from_status, to_status, accrual, source, created_at
+	FROM order_events WHERE order_id = $1
+	ORDER BY id;
+`
+
+const CountOrdersByStatus = `
+	SELECT status, COUNT(*) FROM orders WHERE user_id = $1 GROUP BY status;
+`
@@ -0,0 +1,40 @@
+package queries
+
+// GetUserIDByLogin finds transfer recipients; deleted accounts are not.
+const GetUserIDByLogin = `
+	SELECT id FROM users WHERE login = $1 AND deleted_at IS NULL;
+`
+
+// SumRecentTransfers returns what the user has sent during the last day.
+const SumRecentTransfers = `
+	SELECT COALESCE(SUM(amount), 0) FROM transfers
+	WHERE sender_id = $1 AND created_at > CURRENT_TIMESTAMP - INTERVAL '1 day';
+`
+
+const CreateTransfer = `
+	INSERT INTO transfers (sender_id, recipient_id, amount)
+	VALUES ($1, $2, $3)
+	RETURNING id, created_at;
+`
+
+// PostTransfer writes both sides of the transfer to the ledger.
+const PostTransfer = `
+	INSERT INTO ledger_entries (user_id, kind, amount, transfer_id, created_at)
+	VALUES ($1, 'TRANSFER_OUT', -$3::numeric, $4, $5),
+	       ($2, 'TRANSFER_IN', $3, $4, $5);
+`
+
+// ListTransfersByUser returns transfers sent or received by the user and
+// pages like ListWithdrawalsByUser.
+const ListTransfersByUser = `
+	SELECT t.id, t.sender_id, s.login, t.recipient_id, r.login, t.amount, t.created_at
+	FROM transfers t
+	JOIN users s ON s.id = t.sender_id
+	JOIN users r ON r.id = t.recipient_id
+	WHERE (t.sender_id = $1 OR t.recipient_id = $1)
+	  AND ($2::timestamptz IS NULL OR (t.created_at, t.id) < ($2, $3))
+	  AND ($4::timestamptz IS NULL OR t.created_at >= $4)
+	  AND ($5::timestamptz IS NULL OR t.created_at < $5)
+	ORDER BY t.created_at DESC, t.id DESC
+	LIMIT $6;
+`
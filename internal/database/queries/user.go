@@ -1,10 +1,23 @@
 package queries
 
 const CreateUser = `
-	INSERT INTO users (login, password) 
-	VALUES ($1, $2);
+	INSERT INTO users (login, password, role) 
+	VALUES ($1, $2, $3);
 `
 
 const GetUserByLogin = `
-	SELECT * FROM users WHERE login = $1;
+	SELECT id, login, password, role, created_at FROM users WHERE login = $1;
+`
+
+const SetUserRole = `
+	UPDATE users SET role = $2 WHERE login = $1 RETURNING id;
+`
+
+// AnonymizeUser frees the login of a deleted account and makes its password
+// unusable. The generated login starts with security.DeletedLoginPrefix and
+// is longer than security.IsLoginValid allows, so registration can never
+// produce it.
+const AnonymizeUser = `
+	UPDATE users SET login = 'deleted-' || gen_random_uuid(), password = '', deleted_at = CURRENT_TIMESTAMP
+	WHERE id = $1 AND deleted_at IS NULL;
 `
@@ -0,0 +1,50 @@
+package queries
+
+// LockUser serialises balance debits of a user.
+const LockUser = `
+	SELECT id FROM users WHERE id = $1 FOR UPDATE;
+`
+
+const HasFunds = `
+	SELECT COALESCE(SUM(amount), 0) >= $2 FROM ledger_entries WHERE user_id = $1;
+`
+
+const CreateWithdrawal = `
+	INSERT INTO withdrawals (user_id, order_number, sum)
+	VALUES ($1, $2, $3)
+	RETURNING id, processed_at;
+`
+
+const DebitWithdrawal = `
+	INSERT INTO ledger_entries (user_id, kind, amount, order_number, created_at)
+	VALUES ($1, 'WITHDRAWAL', -$2::numeric, $3, $4);
+`
+
+// ListWithdrawalsByUser pages like ListOrdersByUser, without the status filter.
+const ListWithdrawalsByUser = `
+	SELECT id, user_id, order_number, sum, processed_at, refunded_at, COALESCE(refund_reason, '')
+	FROM withdrawals
+	WHERE user_id = $1
+	  AND ($2::timestamptz IS NULL OR (processed_at, id) < ($2, $3))
+	  AND ($4::timestamptz IS NULL OR processed_at >= $4)
+	  AND ($5::timestamptz IS NULL OR processed_at < $5)
+	ORDER BY processed_at DESC, id DESC
+	LIMIT $6;
+`
+
+// RefundWithdrawal returns no row if the withdrawal does not exist or has
+// already been refunded. The row lock serialises concurrent refunds.
+const RefundWithdrawal = `
+	UPDATE withdrawals SET refunded_at = CURRENT_TIMESTAMP, refund_reason = $2
+	WHERE order_number = $1 AND refunded_at IS NULL
+	RETURNING id, user_id, order_number, sum, processed_at, refunded_at, refund_reason;
+`
+
+const WithdrawalExists = `
+	SELECT EXISTS (SELECT 1 FROM withdrawals WHERE order_number = $1);
+`
+
+const CreditRefund = `
+	INSERT INTO ledger_entries (user_id, kind, amount, order_number, created_at)
+	VALUES ($1, 'REFUND', $2, $3, $4);
+`
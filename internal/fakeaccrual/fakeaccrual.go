@@ -0,0 +1,273 @@
+// Package fakeaccrual is an in-memory implementation of the accrual system
+// protocol for local development and end-to-end runs without the vendor binary.
+package fakeaccrual
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/rshafikov/gophermart/internal/accrual"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	RewardPercent = "%"
+	RewardPoints  = "pt"
+)
+
+type Config struct {
+	// Latency is added to every GET /api/orders/{number} response.
+	Latency time.Duration
+	// ProcessingDelay is how long an order stays REGISTERED/PROCESSING
+	// before its final status is reported.
+	ProcessingDelay time.Duration
+	// InvalidRatio is the fraction of orders, in [0, 1], that end up INVALID.
+	InvalidRatio float64
+	// MinAccrual and MaxAccrual bound the random accrual of auto-registered orders.
+	MinAccrual float64
+	MaxAccrual float64
+	// RequestsPerMinute limits GET /api/orders/{number}; 0 means unlimited.
+	RequestsPerMinute int
+	// AutoRegister makes unknown orders registered on first lookup instead of
+	// being answered with 204.
+	AutoRegister bool
+}
+
+type Good struct {
+	Description string  `json:"description"`
+	Price       float64 `json:"price"`
+}
+
+type RegisterOrder struct {
+	Order string `json:"order"`
+	Goods []Good `json:"goods"`
+}
+
+type RewardRule struct {
+	Match      string  `json:"match"`
+	Reward     float64 `json:"reward"`
+	RewardType string  `json:"reward_type"`
+}
+
+type order struct {
+	registeredAt time.Time
+	status       accrual.Status
+	accrual      *float64
+}
+
+type Server struct {
+	cfg Config
+
+	mu          sync.Mutex
+	orders      map[string]*order
+	rules       []RewardRule
+	windowStart time.Time
+	windowCount int
+
+	now  func() time.Time
+	rand *rand.Rand
+}
+
+func New(cfg Config) *Server {
+	return &Server{
+		cfg:    cfg,
+		orders: make(map[string]*order),
+		now:    time.Now,
+		rand:   rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())),
+	}
+}
+
+func (s *Server) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Get("/api/orders/{number}", s.GetOrder)
+	r.Post("/api/orders", s.RegisterOrder)
+	r.Post("/api/goods", s.RegisterRule)
+	return r
+}
+
+func (s *Server) GetOrder(w http.ResponseWriter, r *http.Request) {
+	if retryAfter, ok := s.allow(); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		http.Error(w, fmt.Sprintf("No more than %d requests per minute allowed", s.cfg.RequestsPerMinute),
+			http.StatusTooManyRequests)
+		return
+	}
+
+	if s.cfg.Latency > 0 {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(s.cfg.Latency):
+		}
+	}
+
+	number := chi.URLParam(r, "number")
+	res, ok := s.lookup(number)
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+func (s *Server) RegisterOrder(w http.ResponseWriter, r *http.Request) {
+	var req RegisterOrder
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Order == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.orders[req.Order]; ok {
+		http.Error(w, "order is already registered", http.StatusConflict)
+		return
+	}
+	s.orders[req.Order] = s.newOrder(s.rewardFor(req.Goods))
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *Server) RegisterRule(w http.ResponseWriter, r *http.Request) {
+	var rule RewardRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := rule.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.rules {
+		if existing.Match == rule.Match {
+			http.Error(w, "match is already registered", http.StatusConflict)
+			return
+		}
+	}
+	s.rules = append(s.rules, rule)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (r RewardRule) validate() error {
+	if r.Match == "" {
+		return errors.New("match is required")
+	}
+	if r.Reward < 0 {
+		return errors.New("reward must not be negative")
+	}
+	if r.RewardType != RewardPercent && r.RewardType != RewardPoints {
+		return fmt.Errorf("reward_type must be %q or %q", RewardPercent, RewardPoints)
+	}
+	return nil
+}
+
+// allow implements a fixed one-minute window limit.
+func (s *Server) allow() (time.Duration, bool) {
+	if s.cfg.RequestsPerMinute <= 0 {
+		return 0, true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.windowStart) >= time.Minute {
+		s.windowStart = now
+		s.windowCount = 0
+	}
+	if s.windowCount >= s.cfg.RequestsPerMinute {
+		return s.windowStart.Add(time.Minute).Sub(now), false
+	}
+	s.windowCount++
+	return 0, true
+}
+
+func (s *Server) lookup(number string) (accrual.OrderAccrual, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[number]
+	if !ok {
+		if !s.cfg.AutoRegister {
+			return accrual.OrderAccrual{}, false
+		}
+		o = s.newOrder(s.randomAccrual())
+		s.orders[number] = o
+	}
+
+	res := accrual.OrderAccrual{Order: number, Status: o.status}
+	switch elapsed := s.now().Sub(o.registeredAt); {
+	case elapsed >= s.cfg.ProcessingDelay:
+		res.Accrual = o.accrual
+	case elapsed >= s.cfg.ProcessingDelay/2:
+		res.Status = accrual.StatusProcessing
+	default:
+		res.Status = accrual.StatusRegistered
+	}
+	return res, true
+}
+
+// newOrder decides the final outcome of an order up front; lookups only
+// reveal it once ProcessingDelay has passed. Callers must hold s.mu.
+func (s *Server) newOrder(amount *float64) *order {
+	o := &order{registeredAt: s.now(), status: accrual.StatusProcessed, accrual: amount}
+	if s.rand.Float64() < s.cfg.InvalidRatio {
+		o.status = accrual.StatusInvalid
+		o.accrual = nil
+	}
+	return o
+}
+
+// rewardFor sums the rewards of the first matching rule for every good.
+// Callers must hold s.mu.
+func (s *Server) rewardFor(goods []Good) *float64 {
+	var total float64
+	var matched bool
+	for _, g := range goods {
+		for _, rule := range s.rules {
+			if !strings.Contains(g.Description, rule.Match) {
+				continue
+			}
+			matched = true
+			if rule.RewardType == RewardPercent {
+				total += g.Price * rule.Reward / 100
+			} else {
+				total += rule.Reward
+			}
+			break
+		}
+	}
+	if !matched {
+		return nil
+	}
+	return round2(total)
+}
+
+// randomAccrual returns an amount in [MinAccrual, MaxAccrual], or nil when
+// both bounds are zero. Callers must hold s.mu.
+func (s *Server) randomAccrual() *float64 {
+	if s.cfg.MinAccrual == 0 && s.cfg.MaxAccrual == 0 {
+		return nil
+	}
+	return round2(s.cfg.MinAccrual + s.rand.Float64()*(s.cfg.MaxAccrual-s.cfg.MinAccrual))
+}
+
+func round2(v float64) *float64 {
+	v = math.Round(v*100) / 100
+	return &v
+}
@@ -0,0 +1,89 @@
+package fakeaccrual
+
+import (
+	"github.com/rshafikov/gophermart/internal/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestServer_GoodsAndOrders(t *testing.T) {
+	s := New(Config{})
+	ts := httptest.NewServer(s.Routes())
+	defer ts.Close()
+
+	var notCompress bool
+	client := core.NewHTTPClient(ts.URL, notCompress)
+
+	resp, _ := client.JSONRequest(t, http.MethodPost, "/api/goods", `{"match":"Bork","reward":10,"reward_type":"%"}`)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, _ = client.JSONRequest(t, http.MethodPost, "/api/goods", `{"match":"Bork","reward":5,"reward_type":"pt"}`)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	resp, _ = client.JSONRequest(t, http.MethodPost, "/api/goods", `{"match":"Acme","reward":5,"reward_type":"pt"}`)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, _ = client.JSONRequest(t, http.MethodPost, "/api/orders",
+		`{"order":"12345678903","goods":[{"description":"Чайник Bork","price":7000},{"description":"Acme anvil","price":100}]}`)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	resp, body := client.URLRequest(t, http.MethodGet, "/api/orders/12345678903")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.JSONEq(t, `{"order":"12345678903","status":"PROCESSED","accrual":705}`, body)
+
+	resp, _ = client.URLRequest(t, http.MethodGet, "/api/orders/9278923470")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
+
+func TestServer_ProcessingDelayAndInvalid(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := New(Config{ProcessingDelay: 10 * time.Second, InvalidRatio: 1, AutoRegister: true})
+	s.now = func() time.Time { return now }
+
+	res, ok := s.lookup("1")
+	require.True(t, ok)
+	assert.Equal(t, "REGISTERED", string(res.Status))
+
+	now = now.Add(5 * time.Second)
+	res, _ = s.lookup("1")
+	assert.Equal(t, "PROCESSING", string(res.Status))
+
+	now = now.Add(5 * time.Second)
+	res, _ = s.lookup("1")
+	assert.Equal(t, "INVALID", string(res.Status))
+	assert.Nil(t, res.Accrual)
+}
+
+func TestServer_RequestsPerMinute(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := New(Config{RequestsPerMinute: 2, AutoRegister: true, MinAccrual: 10, MaxAccrual: 20})
+	s.now = func() time.Time { return now }
+	h := s.Routes()
+
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/orders/1", nil))
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, get().Code)
+	assert.Equal(t, http.StatusOK, get().Code)
+
+	now = now.Add(15 * time.Second)
+	w := get()
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "45", w.Header().Get("Retry-After"))
+
+	now = now.Add(45 * time.Second)
+	assert.Equal(t, http.StatusOK, get().Code)
+}
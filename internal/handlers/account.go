@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rshafikov/gophermart/internal/core/logger"
+	"github.com/rshafikov/gophermart/internal/models"
+	"github.com/rshafikov/gophermart/internal/schemas"
+	"github.com/rshafikov/gophermart/internal/service"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+// AccountHandler serves the requests about the account of the
+// authenticated user as a whole.
+type AccountHandler struct {
+	UserService    *service.UserService
+	OrderService   *service.OrderService
+	BalanceService *service.BalanceService
+}
+
+func NewAccountHandler(
+	userService *service.UserService,
+	orderService *service.OrderService,
+	balanceService *service.BalanceService,
+) *AccountHandler {
+	return &AccountHandler{UserService: userService, OrderService: orderService, BalanceService: balanceService}
+}
+
+// Me describes the authenticated user along with a summary of their balance.
+func (h *AccountHandler) Me(w http.ResponseWriter, r *http.Request) {
+	u, ok := userFromContext(r)
+	if !ok {
+		logger.L.Debug("user not found in context")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	balance, err := h.BalanceService.GetBalance(r.Context(), u.ID)
+	if err != nil {
+		logger.L.Debug("unable to get balance", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, schemas.ProfileResponse{UserResponse: userResponse(u), Balance: balanceResponse(balance)})
+}
+
+// Delete anonymizes the account of the user, who has to confirm it with
+// their password. Issued tokens stop working as the login is released.
+func (h *AccountHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	u, ok := userFromContext(r)
+	if !ok {
+		logger.L.Debug("user not found in context")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	var req schemas.DeleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.L.Debug("unable to decode request body", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := h.UserService.Delete(r.Context(), u.Login, req.Password)
+	switch {
+	case err == nil:
+		logger.L.Info("user deleted", zap.Int("user_id", u.ID))
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, service.ErrPasswordMismatch):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		logger.L.Debug("unable to delete user", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// Export returns the personal data kept about the user as a JSON file.
+func (h *AccountHandler) Export(w http.ResponseWriter, r *http.Request) {
+	u, ok := userFromContext(r)
+	if !ok {
+		logger.L.Debug("user not found in context")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	ctx := r.Context()
+	orders, _, err := h.OrderService.ListByUser(ctx, u.ID, models.OrderQuery{})
+	if err != nil {
+		logger.L.Debug("unable to list orders", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	withdrawals, _, err := h.BalanceService.ListWithdrawals(ctx, u.ID, models.PageQuery{})
+	if err != nil {
+		logger.L.Debug("unable to list withdrawals", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	transactions, _, err := h.BalanceService.ListTransactions(ctx, u.ID, models.TransactionQuery{})
+	if err != nil {
+		logger.L.Debug("unable to list transactions", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := schemas.AccountExport{
+		Profile:      userResponse(u),
+		Orders:       make([]schemas.OrderResponse, 0, len(orders)),
+		Withdrawals:  make([]schemas.WithdrawalResponse, 0, len(withdrawals)),
+		Transactions: make([]schemas.TransactionResponse, 0, len(transactions)),
+		ExportedAt:   time.Now().UTC(),
+	}
+	for _, o := range orders {
+		resp.Orders = append(resp.Orders, orderResponse(o))
+	}
+	for _, wd := range withdrawals {
+		resp.Withdrawals = append(resp.Withdrawals, withdrawalResponse(wd))
+	}
+	for _, t := range transactions {
+		resp.Transactions = append(resp.Transactions, transactionResponse(t))
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="gophermart-%s.json"`, u.Login))
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func userResponse(u *models.User) schemas.UserResponse {
+	return schemas.UserResponse{ID: u.ID, Login: u.Login, Role: string(u.Role), CreatedAt: u.CreatedAt}
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/rshafikov/gophermart/internal/accrual"
+	"github.com/rshafikov/gophermart/internal/core"
+	"github.com/rshafikov/gophermart/internal/core/security"
+	"github.com/rshafikov/gophermart/internal/models"
+	"github.com/rshafikov/gophermart/internal/repository"
+	"github.com/rshafikov/gophermart/internal/schemas"
+	"github.com/rshafikov/gophermart/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAccountHandler_Me(t *testing.T) {
+	orderRepo := repository.NewMockOrderRepository()
+	orderService := service.NewOrderService(orderRepo)
+	balanceService := service.NewBalanceService(orderRepo.Ledger, repository.NewMockWithdrawalRepository(orderRepo.Ledger), orderRepo)
+	handler := NewAccountHandler(service.NewUserService(repository.NewMockUserRepository()), orderService, balanceService)
+
+	r := chi.NewRouter()
+	r.Use(withUser)
+	r.Get("/api/user/me", handler.Me)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	ctx := context.TODO()
+	amount := 700.0
+	require.NoError(t, orderService.Upload(ctx, 1, "12345678903"))
+	require.NoError(t, orderService.ApplyAccrual(ctx, service.SourcePoll, &accrual.OrderAccrual{Order: "12345678903", Status: accrual.StatusProcessed, Accrual: &amount}))
+	_, err := balanceService.Withdraw(ctx, 1, "2377225624", 500)
+	require.NoError(t, err)
+
+	var notCompress bool
+	client := core.NewHTTPClient(ts.URL, notCompress)
+
+	tests := []struct {
+		name    string
+		userID  string
+		profile schemas.ProfileResponse
+	}{
+		{
+			name:   "with points",
+			userID: "1",
+			profile: schemas.ProfileResponse{
+				UserResponse: schemas.UserResponse{ID: 1, Login: "user_1", Role: "user"},
+				Balance:      schemas.BalanceResponse{Current: 200, Withdrawn: 500},
+			},
+		},
+		{
+			name:   "without points",
+			userID: "2",
+			profile: schemas.ProfileResponse{
+				UserResponse: schemas.UserResponse{ID: 2, Login: "user_2", Role: "user"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, body := textRequest(t, client, http.MethodGet, "/api/user/me", "", test.userID)
+			defer resp.Body.Close()
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+
+			var profile schemas.ProfileResponse
+			require.NoError(t, json.Unmarshal([]byte(body), &profile))
+			assert.Equal(t, test.profile, profile)
+			assert.NotContains(t, body, "password")
+		})
+	}
+}
+
+func TestAccountHandler_Delete(t *testing.T) {
+	password, err := security.HashPassword("password")
+	require.NoError(t, err)
+	users := repository.NewMockUserRepository().(*repository.MockUserRepository)
+	users.DB["user_1"] = &models.User{ID: 1, Login: "user_1", Password: password, Role: models.RoleUser}
+	userService := service.NewUserService(users)
+	orderRepo := repository.NewMockOrderRepository()
+	balanceService := service.NewBalanceService(orderRepo.Ledger, repository.NewMockWithdrawalRepository(orderRepo.Ledger), orderRepo)
+	handler := NewAccountHandler(userService, service.NewOrderService(orderRepo), balanceService)
+
+	r := chi.NewRouter()
+	r.Use(withUser)
+	r.Route("/api/user", func(r chi.Router) {
+		r.Delete("/", handler.Delete)
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	var notCompress bool
+	client := core.NewHTTPClient(ts.URL, notCompress)
+
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{name: "invalid json", body: `{"password":`, code: http.StatusBadRequest},
+		{name: "wrong password", body: `{"password":"wrong"}`, code: http.StatusForbidden},
+		{name: "success", body: `{"password":"password"}`, code: http.StatusNoContent},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, _ := textRequest(t, client, http.MethodDelete, "/api/user", test.body, "1")
+			defer resp.Body.Close()
+			assert.Equal(t, test.code, resp.StatusCode)
+		})
+	}
+
+	// The login is released and the account kept under another one.
+	_, err = userService.GetByLogin(context.TODO(), "user_1")
+	assert.ErrorIs(t, err, service.ErrUserNotFound)
+	require.Len(t, users.DB, 1)
+	for login, u := range users.DB {
+		assert.NotEqual(t, "user_1", login)
+		assert.Equal(t, 1, u.ID)
+		assert.Empty(t, u.Password)
+	}
+}
+
+func TestAccountHandler_Export(t *testing.T) {
+	orderRepo := repository.NewMockOrderRepository()
+	orderService := service.NewOrderService(orderRepo)
+	balanceService := service.NewBalanceService(orderRepo.Ledger, repository.NewMockWithdrawalRepository(orderRepo.Ledger), orderRepo)
+	handler := NewAccountHandler(service.NewUserService(repository.NewMockUserRepository()), orderService, balanceService)
+
+	r := chi.NewRouter()
+	r.Use(withUser)
+	r.Get("/api/user/export", handler.Export)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	ctx := context.TODO()
+	amount := 700.0
+	require.NoError(t, orderService.Upload(ctx, 1, "12345678903"))
+	require.NoError(t, orderService.ApplyAccrual(ctx, service.SourcePoll, &accrual.OrderAccrual{Order: "12345678903", Status: accrual.StatusProcessed, Accrual: &amount}))
+	_, err := balanceService.Withdraw(ctx, 1, "2377225624", 500)
+	require.NoError(t, err)
+
+	var notCompress bool
+	client := core.NewHTTPClient(ts.URL, notCompress)
+
+	resp, body := textRequest(t, client, http.MethodGet, "/api/user/export", "", "1")
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `attachment; filename="gophermart-user_1.json"`, resp.Header.Get("Content-Disposition"))
+
+	var export schemas.AccountExport
+	require.NoError(t, json.Unmarshal([]byte(body), &export))
+	assert.Equal(t, "user_1", export.Profile.Login)
+	require.Len(t, export.Orders, 1)
+	assert.Equal(t, "12345678903", export.Orders[0].Number)
+	require.Len(t, export.Withdrawals, 1)
+	assert.Equal(t, "2377225624", export.Withdrawals[0].Order)
+	require.Len(t, export.Transactions, 2)
+	assert.Equal(t, 200.0, export.Transactions[0].Balance)
+
+	// Nothing to export is exported as empty lists.
+	resp, body = textRequest(t, client, http.MethodGet, "/api/user/export", "", "2")
+	resp.Body.Close()
+	assert.Contains(t, body, `"orders":[],"withdrawals":[],"transactions":[]`)
+}
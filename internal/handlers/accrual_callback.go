@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/rshafikov/gophermart/internal/accrual"
+	"github.com/rshafikov/gophermart/internal/core/logger"
+	"github.com/rshafikov/gophermart/internal/models"
+	"github.com/rshafikov/gophermart/internal/service"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// AccrualCallbackHandler accepts accrual results pushed by the accrual system.
+// Requests are authenticated by middlewares.SignatureVerifier.
+type AccrualCallbackHandler struct {
+	OrderService *service.OrderService
+}
+
+func NewAccrualCallbackHandler(orderService *service.OrderService) *AccrualCallbackHandler {
+	return &AccrualCallbackHandler{OrderService: orderService}
+}
+
+func (h *AccrualCallbackHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	var update accrual.OrderAccrual
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		logger.L.Debug("unable to decode request body", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if update.Order == "" {
+		http.Error(w, "order is required", http.StatusBadRequest)
+		return
+	}
+
+	err := h.OrderService.ApplyAccrual(r.Context(), service.SourcePush, &update)
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusOK)
+	case errors.Is(err, service.ErrInvalidAccrualStatus):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrOrderNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrOrderFinalized), errors.Is(err, models.ErrIllegalTransition):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		logger.L.Debug("unable to apply accrual", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
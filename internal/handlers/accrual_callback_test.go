@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"github.com/go-chi/chi/v5"
+	"github.com/rshafikov/gophermart/internal/middlewares"
+	"github.com/rshafikov/gophermart/internal/repository"
+	"github.com/rshafikov/gophermart/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAccrualCallbackHandler_Callback(t *testing.T) {
+	secret := []byte("callback-secret")
+	orderRepo := repository.NewMockOrderRepository()
+	orderService := service.NewOrderService(orderRepo)
+	handler := NewAccrualCallbackHandler(orderService)
+	callbackPath := "/internal/accrual/callback"
+
+	require.NoError(t, orderService.Upload(context.TODO(), 1, "12345678903"))
+
+	r := chi.NewRouter()
+	r.With(middlewares.SignatureVerifier(secret, time.Minute)).Post(callbackPath, handler.Callback)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	tests := []struct {
+		name   string
+		body   string
+		secret []byte
+		code   int
+	}{
+		{name: "processing", body: `{"order":"12345678903","status":"PROCESSING"}`, secret: secret, code: http.StatusOK},
+		{name: "wrong secret", body: `{"order":"12345678903","status":"PROCESSED","accrual":1}`, secret: []byte("x"), code: http.StatusUnauthorized},
+		{name: "processed", body: `{"order":"12345678903","status":"PROCESSED","accrual":729.98}`, secret: secret, code: http.StatusOK},
+		{name: "duplicate delivery", body: `{"order":"12345678903","status":"PROCESSED","accrual":729.98}`, secret: secret, code: http.StatusOK},
+		{name: "conflicting result", body: `{"order":"12345678903","status":"INVALID"}`, secret: secret, code: http.StatusConflict},
+		{name: "unknown order", body: `{"order":"9278923470","status":"INVALID"}`, secret: secret, code: http.StatusNotFound},
+		{name: "unknown status", body: `{"order":"12345678903","status":"DONE"}`, secret: secret, code: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			now := time.Now()
+			req, err := http.NewRequest(http.MethodPost, ts.URL+callbackPath, bytes.NewBufferString(test.body))
+			require.NoError(t, err)
+			req.Header.Set(middlewares.TimestampHeader, strconv.FormatInt(now.Unix(), 10))
+			req.Header.Set(middlewares.SignatureHeader, middlewares.Sign(test.secret, now, []byte(test.body)))
+
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, test.code, resp.StatusCode)
+		})
+	}
+
+	order, err := orderRepo.GetByNumber(context.TODO(), "12345678903")
+	require.NoError(t, err)
+	assert.Equal(t, "PROCESSED", string(order.Status))
+	require.NotNil(t, order.Accrual)
+	assert.Equal(t, 729.98, *order.Accrual)
+}
+
+func TestAccrualCallbackHandler_RoundsAccrual(t *testing.T) {
+	secret := []byte("callback-secret")
+	orderRepo := repository.NewMockOrderRepository()
+	orderService := service.NewOrderService(orderRepo)
+	handler := NewAccrualCallbackHandler(orderService)
+	callbackPath := "/internal/accrual/callback"
+
+	require.NoError(t, orderService.Upload(context.TODO(), 1, "12345678903"))
+
+	r := chi.NewRouter()
+	r.With(middlewares.SignatureVerifier(secret, time.Minute)).Post(callbackPath, handler.Callback)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	body := `{"order":"12345678903","status":"PROCESSED","accrual":729.985}`
+	for i := 0; i < 2; i++ {
+		now := time.Now()
+		req, err := http.NewRequest(http.MethodPost, ts.URL+callbackPath, bytes.NewBufferString(body))
+		require.NoError(t, err)
+		req.Header.Set(middlewares.TimestampHeader, strconv.FormatInt(now.Unix(), 10))
+		req.Header.Set(middlewares.SignatureHeader, middlewares.Sign(secret, now, []byte(body)))
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	order, err := orderRepo.GetByNumber(context.TODO(), "12345678903")
+	require.NoError(t, err)
+	require.NotNil(t, order.Accrual)
+	assert.Equal(t, 729.99, *order.Accrual)
+}
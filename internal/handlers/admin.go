@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/rshafikov/gophermart/internal/core/logger"
+	"github.com/rshafikov/gophermart/internal/models"
+	"github.com/rshafikov/gophermart/internal/schemas"
+	"github.com/rshafikov/gophermart/internal/service"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// AdminHandler serves the support staff API under /api/admin.
+type AdminHandler struct {
+	UserService    *service.UserService
+	OrderService   *service.OrderService
+	BalanceService *service.BalanceService
+	AuditService   *service.AuditService
+}
+
+func NewAdminHandler(
+	userService *service.UserService,
+	orderService *service.OrderService,
+	balanceService *service.BalanceService,
+	auditService *service.AuditService,
+) *AdminHandler {
+	return &AdminHandler{
+		UserService:    userService,
+		OrderService:   orderService,
+		BalanceService: balanceService,
+		AuditService:   auditService,
+	}
+}
+
+// userFromPath looks up the user named by the {login} URL parameter and
+// writes 404 if there is none.
+func (h *AdminHandler) userFromPath(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	u, err := h.UserService.GetByLogin(r.Context(), chi.URLParam(r, "login"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil, false
+	}
+	return u, true
+}
+
+func (h *AdminHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	u, ok := h.userFromPath(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, userResponse(u))
+}
+
+func (h *AdminHandler) ListOrders(w http.ResponseWriter, r *http.Request) {
+	if u, ok := h.userFromPath(w, r); ok {
+		NewOrderHandler(h.OrderService).listOrders(w, r, u.ID)
+	}
+}
+
+func (h *AdminHandler) GetBalance(w http.ResponseWriter, r *http.Request) {
+	if u, ok := h.userFromPath(w, r); ok {
+		NewBalanceHandler(h.BalanceService).writeBalance(w, r, u.ID)
+	}
+}
+
+func (h *AdminHandler) ListTransactions(w http.ResponseWriter, r *http.Request) {
+	if u, ok := h.userFromPath(w, r); ok {
+		NewBalanceHandler(h.BalanceService).listTransactions(w, r, u.ID)
+	}
+}
+
+// Adjust credits or, with a negative amount, debits the user's balance.
+func (h *AdminHandler) Adjust(w http.ResponseWriter, r *http.Request) {
+	actor, ok := userFromContext(r)
+	if !ok {
+		logger.L.Debug("user not found in context")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	u, ok := h.userFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req schemas.AdjustmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.L.Debug("unable to decode request body", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	e, err := h.BalanceService.Adjust(r.Context(), actor, u, req.Amount, req.Reason)
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusCreated, schemas.TransactionResponse{
+			ID:        e.ID,
+			Type:      string(e.Kind),
+			Amount:    e.Amount,
+			Reason:    e.Reason,
+			CreatedAt: e.CreatedAt,
+		})
+	case errors.Is(err, service.ErrInvalidAmount), errors.Is(err, service.ErrReasonRequired):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrSelfAdjustment), errors.Is(err, service.ErrStaffAdjustment):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, service.ErrInsufficientFunds):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		logger.L.Debug("unable to adjust balance", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *AdminHandler) SetRole(w http.ResponseWriter, r *http.Request) {
+	actor, ok := userFromContext(r)
+	if !ok {
+		logger.L.Debug("user not found in context")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	var req schemas.RoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.L.Debug("unable to decode request body", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := h.UserService.SetRole(r.Context(), actor.ID, chi.URLParam(r, "login"), models.Role(req.Role), req.Reason)
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, service.ErrInvalidRole):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrUserNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		logger.L.Debug("unable to set role", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *AdminHandler) RefundWithdrawal(w http.ResponseWriter, r *http.Request) {
+	actor, ok := userFromContext(r)
+	if !ok {
+		logger.L.Debug("user not found in context")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	var req schemas.RefundRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.L.Debug("unable to decode request body", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	wd, err := h.BalanceService.RefundWithdrawal(r.Context(), actor.ID, chi.URLParam(r, "order"), req.Reason)
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, withdrawalResponse(wd))
+	case errors.Is(err, service.ErrReasonRequired):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrWithdrawalNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrWithdrawalRefunded):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		logger.L.Debug("unable to refund withdrawal", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// ListAudit pages through the audit log, optionally filtered by the actor
+// and user logins and by time.
+func (h *AdminHandler) ListAudit(w http.ResponseWriter, r *http.Request) {
+	page, paginated, err := parsePageQuery(r, "actor", "user")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	q := models.AuditQuery{PageQuery: page}
+	var ok bool
+	if q.ActorID, ok = h.userIDFromQuery(w, r, "actor"); !ok {
+		return
+	}
+	if q.UserID, ok = h.userIDFromQuery(w, r, "user"); !ok {
+		return
+	}
+
+	entries, next, err := h.AuditService.List(r.Context(), q)
+	if err != nil {
+		logger.L.Debug("unable to list audit log", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(entries) == 0 && !paginated {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	resp := make([]schemas.AuditEntryResponse, 0, len(entries))
+	for _, e := range entries {
+		resp = append(resp, schemas.AuditEntryResponse{
+			ID:        e.ID,
+			Actor:     e.Actor,
+			User:      e.User,
+			Action:    string(e.Action),
+			Reason:    e.Reason,
+			Details:   e.Details,
+			CreatedAt: e.CreatedAt,
+		})
+	}
+
+	setNextPage(w, r, next)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// userIDFromQuery resolves the login given in the query parameter, if any,
+// and writes 404 if there is no such user.
+func (h *AdminHandler) userIDFromQuery(w http.ResponseWriter, r *http.Request, param string) (*int, bool) {
+	login := r.URL.Query().Get(param)
+	if login == "" {
+		return nil, true
+	}
+	u, err := h.UserService.GetByLogin(r.Context(), login)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s: %s", param, err), http.StatusNotFound)
+		return nil, false
+	}
+	return &u.ID, true
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/rshafikov/gophermart/internal/accrual"
+	"github.com/rshafikov/gophermart/internal/core"
+	"github.com/rshafikov/gophermart/internal/models"
+	"github.com/rshafikov/gophermart/internal/repository"
+	"github.com/rshafikov/gophermart/internal/schemas"
+	"github.com/rshafikov/gophermart/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminHandler_RefundWithdrawal(t *testing.T) {
+	orderRepo := repository.NewMockOrderRepository()
+	orderService := service.NewOrderService(orderRepo)
+	balanceService := service.NewBalanceService(orderRepo.Ledger, repository.NewMockWithdrawalRepository(orderRepo.Ledger), orderRepo)
+	balanceHandler := NewBalanceHandler(balanceService)
+	auditService := service.NewAuditService(orderRepo.Ledger.Audit)
+	handler := NewAdminHandler(service.NewUserService(repository.NewMockUserRepository()), orderService, balanceService, auditService)
+
+	r := chi.NewRouter()
+	r.Use(withUser)
+	r.Get("/api/user/balance", balanceHandler.GetBalance)
+	r.Get("/api/user/withdrawals", balanceHandler.ListWithdrawals)
+	r.Post("/api/admin/withdrawals/{order}/refund", handler.RefundWithdrawal)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	ctx := context.TODO()
+	amount := 700.0
+	require.NoError(t, orderService.Upload(ctx, 1, "12345678903"))
+	require.NoError(t, orderService.ApplyAccrual(ctx, service.SourcePoll, &accrual.OrderAccrual{Order: "12345678903", Status: accrual.StatusProcessed, Accrual: &amount}))
+	_, err := balanceService.Withdraw(ctx, 1, "2377225624", 500)
+	require.NoError(t, err)
+	_, err = balanceService.Withdraw(ctx, 1, "9278923470", 100)
+	require.NoError(t, err)
+
+	var notCompress bool
+	client := core.NewHTTPClient(ts.URL, notCompress)
+
+	tests := []struct {
+		name  string
+		order string
+		body  string
+		code  int
+	}{
+		{name: "reason is required", order: "2377225624", body: `{"reason":" "}`, code: http.StatusBadRequest},
+		{name: "invalid json", order: "2377225624", body: `{"reason":`, code: http.StatusBadRequest},
+		{name: "unknown withdrawal", order: "12345678903", body: `{"reason":"order cancelled"}`, code: http.StatusNotFound},
+		{name: "success", order: "2377225624", body: `{"reason":"order cancelled"}`, code: http.StatusOK},
+		{name: "already refunded", order: "2377225624", body: `{"reason":"order cancelled"}`, code: http.StatusConflict},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, _ := textRequest(t, client, http.MethodPost, "/api/admin/withdrawals/"+test.order+"/refund", test.body, "")
+			defer resp.Body.Close()
+			assert.Equal(t, test.code, resp.StatusCode)
+		})
+	}
+
+	resp, body := textRequest(t, client, http.MethodGet, "/api/user/balance", "", "1")
+	resp.Body.Close()
+	assert.JSONEq(t, `{"current":600,"withdrawn":100}`, body)
+
+	resp, body = textRequest(t, client, http.MethodGet, "/api/user/withdrawals", "", "1")
+	resp.Body.Close()
+	assert.Contains(t, body, `"order":"9278923470","sum":100,"processed_at"`)
+	assert.Contains(t, body, `"status":"PROCESSED"`)
+	assert.Contains(t, body, `"order":"2377225624","sum":500,"processed_at"`)
+	assert.Contains(t, body, `"status":"REFUNDED","refunded_at"`)
+
+	require.Len(t, orderRepo.Ledger.Audit.Entries, 1)
+	audit := orderRepo.Ledger.Audit.Entries[0]
+	assert.Equal(t, 1, audit.ActorID)
+	assert.Equal(t, 1, audit.UserID)
+	assert.Equal(t, "order cancelled", audit.Reason)
+	assert.Equal(t, map[string]any{"order": "2377225624"}, audit.Details)
+}
+
+func TestAdminHandler_Users(t *testing.T) {
+	users := repository.NewMockUserRepository().(*repository.MockUserRepository)
+	users.DB["user_1"] = &models.User{ID: 1, Login: "user_1", Role: models.RoleUser}
+	users.DB["user_2"] = &models.User{ID: 2, Login: "user_2", Role: models.RoleUser}
+	users.DB["staff"] = &models.User{ID: 3, Login: "staff", Role: models.RoleSupport}
+	orderRepo := repository.NewMockOrderRepository()
+	users.Audit = orderRepo.Ledger.Audit
+	orderService := service.NewOrderService(orderRepo)
+	balanceService := service.NewBalanceService(orderRepo.Ledger, repository.NewMockWithdrawalRepository(orderRepo.Ledger), orderRepo)
+	auditService := service.NewAuditService(orderRepo.Ledger.Audit)
+	handler := NewAdminHandler(service.NewUserService(users), orderService, balanceService, auditService)
+
+	r := chi.NewRouter()
+	r.Use(withUser)
+	r.Get("/api/admin/users/{login}", handler.GetUser)
+	r.Get("/api/admin/users/{login}/orders", handler.ListOrders)
+	r.Get("/api/admin/users/{login}/balance", handler.GetBalance)
+	r.Get("/api/admin/users/{login}/transactions", handler.ListTransactions)
+	r.Post("/api/admin/users/{login}/adjustments", handler.Adjust)
+	r.Put("/api/admin/users/{login}/role", handler.SetRole)
+	r.Get("/api/admin/audit", handler.ListAudit)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	require.NoError(t, orderService.Upload(context.TODO(), 1, "12345678903"))
+
+	var notCompress bool
+	client := core.NewHTTPClient(ts.URL, notCompress)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		{name: "unknown user", method: http.MethodGet, path: "/users/nobody", code: http.StatusNotFound},
+		{name: "user", method: http.MethodGet, path: "/users/user_1", code: http.StatusOK},
+		{name: "orders", method: http.MethodGet, path: "/users/user_1/orders", code: http.StatusOK},
+		{name: "no transactions", method: http.MethodGet, path: "/users/user_1/transactions", code: http.StatusNoContent},
+		{name: "empty audit log", method: http.MethodGet, path: "/audit", code: http.StatusNoContent},
+		{name: "zero adjustment", method: http.MethodPost, path: "/users/user_2/adjustments", body: `{"amount":0,"reason":"goodwill"}`, code: http.StatusBadRequest},
+		{name: "fractional cents", method: http.MethodPost, path: "/users/user_2/adjustments", body: `{"amount":1.005,"reason":"goodwill"}`, code: http.StatusBadRequest},
+		{name: "reason is required", method: http.MethodPost, path: "/users/user_2/adjustments", body: `{"amount":10}`, code: http.StatusBadRequest},
+		{name: "overdraft", method: http.MethodPost, path: "/users/user_2/adjustments", body: `{"amount":-10,"reason":"fraud"}`, code: http.StatusConflict},
+		{name: "own balance", method: http.MethodPost, path: "/users/user_1/adjustments", body: `{"amount":50,"reason":"goodwill"}`, code: http.StatusForbidden},
+		{name: "staff balance", method: http.MethodPost, path: "/users/staff/adjustments", body: `{"amount":50,"reason":"goodwill"}`, code: http.StatusForbidden},
+		{name: "credit", method: http.MethodPost, path: "/users/user_2/adjustments", body: `{"amount":50,"reason":"goodwill"}`, code: http.StatusCreated},
+		{name: "debit", method: http.MethodPost, path: "/users/user_2/adjustments", body: `{"amount":-20.5,"reason":"fraud"}`, code: http.StatusCreated},
+		{name: "unknown user adjustment", method: http.MethodPost, path: "/users/nobody/adjustments", body: `{"amount":50,"reason":"goodwill"}`, code: http.StatusNotFound},
+		{name: "invalid role", method: http.MethodPut, path: "/users/user_2/role", body: `{"role":"root"}`, code: http.StatusBadRequest},
+		{name: "unknown user role", method: http.MethodPut, path: "/users/nobody/role", body: `{"role":"support"}`, code: http.StatusNotFound},
+		{name: "role", method: http.MethodPut, path: "/users/user_2/role", body: `{"role":"support","reason":"new hire"}`, code: http.StatusNoContent},
+		{name: "unknown actor", method: http.MethodGet, path: "/audit?actor=nobody", code: http.StatusNotFound},
+		{name: "invalid audit query", method: http.MethodGet, path: "/audit?limit=0", code: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, _ := textRequest(t, client, test.method, "/api/admin"+test.path, test.body, "")
+			defer resp.Body.Close()
+			assert.Equal(t, test.code, resp.StatusCode)
+		})
+	}
+
+	resp, body := textRequest(t, client, http.MethodGet, "/api/admin/users/user_2/balance", "", "")
+	resp.Body.Close()
+	assert.JSONEq(t, `{"current":29.5,"withdrawn":0}`, body)
+
+	resp, body = textRequest(t, client, http.MethodGet, "/api/admin/users/user_2/transactions", "", "")
+	resp.Body.Close()
+	assert.Contains(t, body, `"type":"ADJUSTMENT","amount":-20.5,"balance":29.5,"reason":"fraud"`)
+
+	resp, body = textRequest(t, client, http.MethodGet, "/api/admin/users/user_2", "", "")
+	resp.Body.Close()
+	assert.Contains(t, body, `"id":2,"login":"user_2","role":"support"`)
+
+	// Rejected actions leave no trace.
+	resp, body = textRequest(t, client, http.MethodGet, "/api/admin/audit?user=user_2&limit=2", "", "")
+	resp.Body.Close()
+	var audit []schemas.AuditEntryResponse
+	require.NoError(t, json.Unmarshal([]byte(body), &audit))
+	require.Len(t, audit, 2)
+	assert.Equal(t, "ROLE_CHANGE", audit[0].Action)
+	assert.Equal(t, "new hire", audit[0].Reason)
+	assert.Equal(t, map[string]any{"from": "user", "to": "support"}, audit[0].Details)
+	assert.Equal(t, "ADJUSTMENT", audit[1].Action)
+	assert.Equal(t, map[string]any{"amount": -20.5}, audit[1].Details)
+	assert.NotEmpty(t, resp.Header.Get("Link"))
+}
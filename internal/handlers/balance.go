@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rshafikov/gophermart/internal/core/logger"
+	"github.com/rshafikov/gophermart/internal/models"
+	"github.com/rshafikov/gophermart/internal/schemas"
+	"github.com/rshafikov/gophermart/internal/service"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type BalanceHandler struct {
+	BalanceService *service.BalanceService
+}
+
+func NewBalanceHandler(balanceService *service.BalanceService) *BalanceHandler {
+	return &BalanceHandler{BalanceService: balanceService}
+}
+
+func (h *BalanceHandler) GetBalance(w http.ResponseWriter, r *http.Request) {
+	u, ok := userFromContext(r)
+	if !ok {
+		logger.L.Debug("user not found in context")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	h.writeBalance(w, r, u.ID)
+}
+
+// writeBalance is shared with the admin API.
+func (h *BalanceHandler) writeBalance(w http.ResponseWriter, r *http.Request, userID int) {
+
+	var details bool
+	if v := r.URL.Query().Get("details"); v != "" {
+		var err error
+		if details, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "details must be a boolean", http.StatusBadRequest)
+			return
+		}
+	}
+
+	balance, err := h.BalanceService.GetBalance(r.Context(), userID)
+	if err != nil {
+		logger.L.Debug("unable to get balance", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := balanceResponse(balance)
+	if details {
+		pending, err := h.BalanceService.GetPendingOrders(r.Context(), userID)
+		if err != nil {
+			logger.L.Debug("unable to count pending orders", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp.Pending = &schemas.PendingOrdersResponse{Orders: pending.Total(), New: pending.New, Processing: pending.Processing}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *BalanceHandler) Withdraw(w http.ResponseWriter, r *http.Request) {
+	u, ok := userFromContext(r)
+	if !ok {
+		logger.L.Debug("user not found in context")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	var req schemas.WithdrawRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.L.Debug("unable to decode request body", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, err := h.BalanceService.Withdraw(r.Context(), u.ID, req.Order, req.Sum)
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusOK)
+	case errors.Is(err, service.ErrInsufficientFunds):
+		http.Error(w, err.Error(), http.StatusPaymentRequired)
+	case errors.Is(err, service.ErrInvalidOrderNumber), errors.Is(err, service.ErrInvalidSum):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, service.ErrWithdrawalExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		logger.L.Debug("unable to withdraw", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *BalanceHandler) ListWithdrawals(w http.ResponseWriter, r *http.Request) {
+	u, ok := userFromContext(r)
+	if !ok {
+		logger.L.Debug("user not found in context")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	q, paginated, err := parsePageQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	withdrawals, next, err := h.BalanceService.ListWithdrawals(r.Context(), u.ID, q)
+	if err != nil {
+		logger.L.Debug("unable to list withdrawals", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(withdrawals) == 0 && !paginated {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	resp := make([]schemas.WithdrawalResponse, 0, len(withdrawals))
+	for _, wd := range withdrawals {
+		resp = append(resp, withdrawalResponse(wd))
+	}
+
+	setNextPage(w, r, next)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func balanceResponse(b *models.Balance) schemas.BalanceResponse {
+	resp := schemas.BalanceResponse{Current: b.Current, Withdrawn: b.Withdrawn}
+	for _, lot := range b.Expiring {
+		resp.Expiring = append(resp.Expiring, schemas.ExpiringPointsResponse{Amount: lot.Amount, ExpiresAt: lot.ExpiresAt})
+	}
+	return resp
+}
+
+func withdrawalResponse(wd *models.Withdrawal) schemas.WithdrawalResponse {
+	resp := schemas.WithdrawalResponse{
+		Order:       wd.Order,
+		Sum:         wd.Sum,
+		ProcessedAt: wd.ProcessedAt,
+		Status:      schemas.WithdrawalProcessed,
+	}
+	if wd.Refunded() {
+		resp.Status = schemas.WithdrawalRefunded
+		resp.RefundedAt = wd.RefundedAt
+	}
+	return resp
+}
+
+func (h *BalanceHandler) ListTransactions(w http.ResponseWriter, r *http.Request) {
+	u, ok := userFromContext(r)
+	if !ok {
+		logger.L.Debug("user not found in context")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	h.listTransactions(w, r, u.ID)
+}
+
+// listTransactions is shared with the admin API.
+func (h *BalanceHandler) listTransactions(w http.ResponseWriter, r *http.Request, userID int) {
+
+	q, paginated, err := parseTransactionQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	transactions, next, err := h.BalanceService.ListTransactions(r.Context(), userID, q)
+	if err != nil {
+		logger.L.Debug("unable to list transactions", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(transactions) == 0 && !paginated {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	resp := make([]schemas.TransactionResponse, 0, len(transactions))
+	for _, t := range transactions {
+		resp = append(resp, transactionResponse(t))
+	}
+
+	setNextPage(w, r, next)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func transactionResponse(t *models.Transaction) schemas.TransactionResponse {
+	return schemas.TransactionResponse{
+		ID:          t.ID,
+		Type:        string(t.Kind),
+		Amount:      t.Amount,
+		Balance:     t.Balance,
+		Order:       t.OrderNumber,
+		Counterpart: t.Counterpart,
+		Reason:      t.Reason,
+		CreatedAt:   t.CreatedAt,
+	}
+}
+
+func parseTransactionQuery(r *http.Request) (models.TransactionQuery, bool, error) {
+	page, paginated, err := parsePageQuery(r, "type")
+	if err != nil {
+		return models.TransactionQuery{}, paginated, err
+	}
+
+	q := models.TransactionQuery{PageQuery: page}
+	if v := r.URL.Query().Get("type"); v != "" {
+		for _, s := range strings.Split(v, ",") {
+			kind := models.LedgerEntryKind(strings.ToUpper(strings.TrimSpace(s)))
+			if !kind.Valid() {
+				return q, paginated, fmt.Errorf("%w: unknown type %q", errInvalidListQuery, s)
+			}
+			q.Kinds = append(q.Kinds, kind)
+		}
+	}
+	return q, paginated, nil
+}
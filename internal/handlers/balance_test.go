@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"context"
+	"github.com/go-chi/chi/v5"
+	"github.com/rshafikov/gophermart/internal/accrual"
+	"github.com/rshafikov/gophermart/internal/core"
+	"github.com/rshafikov/gophermart/internal/repository"
+	"github.com/rshafikov/gophermart/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBalanceHandler_GetBalance(t *testing.T) {
+	orderRepo := repository.NewMockOrderRepository()
+	orderService := service.NewOrderService(orderRepo)
+	handler := NewBalanceHandler(service.NewBalanceService(orderRepo.Ledger, repository.NewMockWithdrawalRepository(orderRepo.Ledger), orderRepo))
+	apiBalancePath := "/api/user/balance"
+
+	r := chi.NewRouter()
+	r.Use(withUser)
+	r.Get(apiBalancePath, handler.GetBalance)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	ctx := context.TODO()
+	amount := 500.5
+	for _, number := range []string{"12345678903", "9278923470"} {
+		require.NoError(t, orderService.Upload(ctx, 1, number))
+		res := &accrual.OrderAccrual{Order: number, Status: accrual.StatusProcessed, Accrual: &amount}
+		require.NoError(t, orderService.ApplyAccrual(ctx, service.SourcePoll, res))
+		require.NoError(t, orderService.ApplyAccrual(ctx, service.SourcePush, res), "duplicate delivery")
+	}
+	require.NoError(t, orderService.Upload(ctx, 1, "346436439"))
+	require.NoError(t, orderService.Upload(ctx, 1, "2377225624"))
+	require.NoError(t, orderService.ApplyAccrual(ctx, service.SourcePoll, &accrual.OrderAccrual{Order: "2377225624", Status: accrual.StatusProcessing}))
+
+	var notCompress bool
+	client := core.NewHTTPClient(ts.URL, notCompress)
+
+	tests := []struct {
+		name   string
+		query  string
+		userID string
+		code   int
+		body   string
+	}{
+		{name: "credited user", userID: "1", code: http.StatusOK, body: `{"current":1001,"withdrawn":0}`},
+		{name: "empty balance", userID: "2", code: http.StatusOK, body: `{"current":0,"withdrawn":0}`},
+		{
+			name: "pending orders", query: "?details=true", userID: "1", code: http.StatusOK,
+			body: `{"current":1001,"withdrawn":0,"pending":{"orders":2,"new":1,"processing":1}}`,
+		},
+		{
+			name: "nothing pending", query: "?details=1", userID: "2", code: http.StatusOK,
+			body: `{"current":0,"withdrawn":0,"pending":{"orders":0,"new":0,"processing":0}}`,
+		},
+		{name: "invalid details", query: "?details=yes", userID: "1", code: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, body := textRequest(t, client, http.MethodGet, apiBalancePath+test.query, "", test.userID)
+			defer resp.Body.Close()
+
+			assert.Equal(t, test.code, resp.StatusCode)
+			if test.body != "" {
+				assert.JSONEq(t, test.body, body)
+			}
+		})
+	}
+}
+
+func TestBalanceHandler_Withdraw(t *testing.T) {
+	orderRepo := repository.NewMockOrderRepository()
+	orderService := service.NewOrderService(orderRepo)
+	handler := NewBalanceHandler(service.NewBalanceService(orderRepo.Ledger, repository.NewMockWithdrawalRepository(orderRepo.Ledger), orderRepo))
+
+	r := chi.NewRouter()
+	r.Use(withUser)
+	r.Post("/api/user/balance/withdraw", handler.Withdraw)
+	r.Get("/api/user/balance", handler.GetBalance)
+	r.Get("/api/user/withdrawals", handler.ListWithdrawals)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	ctx := context.TODO()
+	amount := 700.0
+	require.NoError(t, orderService.Upload(ctx, 1, "12345678903"))
+	require.NoError(t, orderService.ApplyAccrual(ctx, service.SourcePoll, &accrual.OrderAccrual{Order: "12345678903", Status: accrual.StatusProcessed, Accrual: &amount}))
+
+	var notCompress bool
+	client := core.NewHTTPClient(ts.URL, notCompress)
+
+	resp, _ := textRequest(t, client, http.MethodGet, "/api/user/withdrawals", "", "1")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{name: "success", body: `{"order":"2377225624","sum":500}`, code: http.StatusOK},
+		{name: "insufficient funds", body: `{"order":"9278923470","sum":200.01}`, code: http.StatusPaymentRequired},
+		{name: "invalid order number", body: `{"order":"2377225625","sum":1}`, code: http.StatusUnprocessableEntity},
+		{name: "negative sum", body: `{"order":"9278923470","sum":-1}`, code: http.StatusUnprocessableEntity},
+		{name: "sub-cent sum", body: `{"order":"9278923470","sum":0.001}`, code: http.StatusUnprocessableEntity},
+		{name: "order already used", body: `{"order":"2377225624","sum":1}`, code: http.StatusConflict},
+		{name: "invalid json", body: `{"order":`, code: http.StatusBadRequest},
+		{name: "rest of the balance", body: `{"order":"9278923470","sum":200}`, code: http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, _ := textRequest(t, client, http.MethodPost, "/api/user/balance/withdraw", test.body, "1")
+			defer resp.Body.Close()
+			assert.Equal(t, test.code, resp.StatusCode)
+		})
+	}
+
+	resp, body := textRequest(t, client, http.MethodGet, "/api/user/balance", "", "1")
+	resp.Body.Close()
+	assert.JSONEq(t, `{"current":0,"withdrawn":700}`, body)
+
+	resp, body = textRequest(t, client, http.MethodGet, "/api/user/withdrawals", "", "1")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, `"order":"9278923470","sum":200,"processed_at"`)
+	assert.Less(t, strings.Index(body, "9278923470"), strings.Index(body, "2377225624"), "newest first")
+}
+
+func TestBalanceHandler_ListTransactions(t *testing.T) {
+	orderRepo := repository.NewMockOrderRepository()
+	orderService := service.NewOrderService(orderRepo)
+	withdrawals := repository.NewMockWithdrawalRepository(orderRepo.Ledger)
+	balanceService := service.NewBalanceService(orderRepo.Ledger, withdrawals, orderRepo)
+	handler := NewBalanceHandler(balanceService)
+
+	r := chi.NewRouter()
+	r.Use(withUser)
+	r.Get("/api/user/transactions", handler.ListTransactions)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	var notCompress bool
+	client := core.NewHTTPClient(ts.URL, notCompress)
+
+	resp, _ := textRequest(t, client, http.MethodGet, "/api/user/transactions", "", "1")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	ctx := context.TODO()
+	amount := 700.0
+	require.NoError(t, orderService.Upload(ctx, 1, "12345678903"))
+	require.NoError(t, orderService.ApplyAccrual(ctx, service.SourcePoll, &accrual.OrderAccrual{Order: "12345678903", Status: accrual.StatusProcessed, Accrual: &amount}))
+	_, err := balanceService.Withdraw(ctx, 1, "2377225624", 500)
+	require.NoError(t, err)
+	_, err = balanceService.Withdraw(ctx, 1, "9278923470", 100)
+	require.NoError(t, err)
+	_, err = balanceService.RefundWithdrawal(ctx, 1, "2377225624", "order cancelled")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		query string
+		code  int
+		want  []string
+		next  bool
+	}{
+		{
+			name: "all entries, newest first",
+			code: http.StatusOK,
+			want: []string{
+				`"type":"REFUND","amount":500,"balance":600,"order":"2377225624"`,
+				`"type":"WITHDRAWAL","amount":-100,"balance":100,"order":"9278923470"`,
+				`"type":"WITHDRAWAL","amount":-500,"balance":200,"order":"2377225624"`,
+				`"type":"ACCRUAL","amount":700,"balance":700,"order":"12345678903"`,
+			},
+		},
+		{
+			name:  "first page",
+			query: "?limit=1",
+			code:  http.StatusOK,
+			want:  []string{`"type":"REFUND","amount":500,"balance":600`},
+			next:  true,
+		},
+		{
+			name:  "filtered by type",
+			query: "?type=withdrawal,accrual&limit=2",
+			code:  http.StatusOK,
+			want:  []string{`"amount":-100,"balance":100`, `"amount":-500,"balance":200`},
+			next:  true,
+		},
+		{name: "unknown type", query: "?type=bonus", code: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, body := textRequest(t, client, http.MethodGet, "/api/user/transactions"+test.query, "", "1")
+			defer resp.Body.Close()
+
+			assert.Equal(t, test.code, resp.StatusCode)
+			for i, want := range test.want {
+				assert.Contains(t, body, want)
+				if i > 0 {
+					assert.Less(t, strings.Index(body, test.want[i-1]), strings.Index(body, want))
+				}
+			}
+			if test.code == http.StatusOK {
+				assert.Equal(t, strings.Count(body, `"type"`), len(test.want))
+			}
+			assert.Equal(t, test.next, resp.Header.Get("X-Next-Cursor") != "")
+		})
+	}
+}
@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/rshafikov/gophermart/internal/core/contextkeys"
+	"github.com/rshafikov/gophermart/internal/core/logger"
+	"github.com/rshafikov/gophermart/internal/models"
+	"github.com/rshafikov/gophermart/internal/schemas"
+	"github.com/rshafikov/gophermart/internal/service"
+	"go.uber.org/zap"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxBatchOrders   = 1000
+	maxBatchBodySize = 1 << 20
+)
+
+type OrderHandler struct {
+	OrderService *service.OrderService
+}
+
+func NewOrderHandler(orderService *service.OrderService) *OrderHandler {
+	return &OrderHandler{OrderService: orderService}
+}
+
+func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
+	u, ok := userFromContext(r)
+	if !ok {
+		logger.L.Debug("user not found in context")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		logger.L.Debug("unable to read request body", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	number := strings.TrimSpace(string(body))
+	if number == "" {
+		http.Error(w, "empty order number", http.StatusBadRequest)
+		return
+	}
+
+	err = h.OrderService.Upload(r.Context(), u.ID, number)
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusAccepted)
+	case errors.Is(err, service.ErrOrderAlreadyUploaded):
+		w.WriteHeader(http.StatusOK)
+	case errors.Is(err, service.ErrOrderOwnedByAnotherUser):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrInvalidOrderNumber):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		logger.L.Debug("unable to upload order", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// CreateOrderBatch accepts a JSON array of order numbers or text/plain with
+// one number per line.
+func (h *OrderHandler) CreateOrderBatch(w http.ResponseWriter, r *http.Request) {
+	u, ok := userFromContext(r)
+	if !ok {
+		logger.L.Debug("user not found in context")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	numbers, err := readOrderNumbers(http.MaxBytesReader(w, r.Body, maxBatchBodySize), r.Header.Get("Content-Type"))
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		http.Error(w, "request body is too large", http.StatusRequestEntityTooLarge)
+		return
+	case err != nil:
+		logger.L.Debug("unable to read order numbers", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case len(numbers) == 0:
+		http.Error(w, "no order numbers", http.StatusBadRequest)
+		return
+	case len(numbers) > maxBatchOrders:
+		http.Error(w, fmt.Sprintf("no more than %d order numbers per batch", maxBatchOrders), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	results, err := h.OrderService.UploadBatch(r.Context(), u.ID, numbers)
+	if err != nil {
+		logger.L.Debug("unable to upload orders", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]schemas.OrderUploadResult, 0, len(results))
+	for _, res := range results {
+		resp = append(resp, schemas.OrderUploadResult{Number: res.Number, Result: res.Result})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func readOrderNumbers(body io.Reader, contentType string) ([]string, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "application/json" {
+		var numbers []string
+		if err := json.NewDecoder(body).Decode(&numbers); err != nil {
+			return nil, err
+		}
+		for i := range numbers {
+			numbers[i] = strings.TrimSpace(numbers[i])
+		}
+		return numbers, nil
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	var numbers []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if number := strings.TrimSpace(line); number != "" {
+			numbers = append(numbers, number)
+		}
+	}
+	return numbers, nil
+}
+
+func (h *OrderHandler) ListOrders(w http.ResponseWriter, r *http.Request) {
+	u, ok := userFromContext(r)
+	if !ok {
+		logger.L.Debug("user not found in context")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	h.listOrders(w, r, u.ID)
+}
+
+// listOrders is shared with the admin API.
+func (h *OrderHandler) listOrders(w http.ResponseWriter, r *http.Request, userID int) {
+
+	q, paginated, err := parseOrderQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	orders, next, err := h.OrderService.ListByUser(r.Context(), userID, q)
+	if err != nil {
+		logger.L.Debug("unable to list orders", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(orders) == 0 && !paginated {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	resp := make([]schemas.OrderResponse, 0, len(orders))
+	for _, o := range orders {
+		resp = append(resp, orderResponse(o))
+	}
+
+	setNextPage(w, r, next)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// parseOrderQuery adds the status filter, a comma separated list, to the
+// common listing parameters.
+func parseOrderQuery(r *http.Request) (models.OrderQuery, bool, error) {
+	page, paginated, err := parsePageQuery(r, "status")
+	if err != nil {
+		return models.OrderQuery{}, paginated, err
+	}
+
+	q := models.OrderQuery{PageQuery: page}
+	if v := r.URL.Query().Get("status"); v != "" {
+		for _, s := range strings.Split(v, ",") {
+			status := models.OrderStatus(strings.ToUpper(strings.TrimSpace(s)))
+			switch status {
+			case models.OrderStatusNew, models.OrderStatusProcessing, models.OrderStatusInvalid, models.OrderStatusProcessed:
+				q.Statuses = append(q.Statuses, status)
+			default:
+				return q, paginated, fmt.Errorf("%w: unknown status %q", errInvalidListQuery, s)
+			}
+		}
+	}
+	return q, paginated, nil
+}
+
+func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
+	u, ok := userFromContext(r)
+	if !ok {
+		logger.L.Debug("user not found in context")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	var refresh bool
+	if v := r.URL.Query().Get("refresh"); v != "" {
+		var err error
+		if refresh, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "refresh must be a boolean", http.StatusBadRequest)
+			return
+		}
+	}
+
+	order, err := h.OrderService.Get(r.Context(), u.ID, chi.URLParam(r, "number"), refresh)
+	switch {
+	case errors.Is(err, service.ErrOrderNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		logger.L.Debug("unable to get order", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, schemas.OrderDetailResponse{
+		OrderResponse: orderResponse(order),
+		UpdatedAt:     order.UpdatedAt,
+	})
+}
+
+func (h *OrderHandler) OrderHistory(w http.ResponseWriter, r *http.Request) {
+	u, ok := userFromContext(r)
+	if !ok {
+		logger.L.Debug("user not found in context")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	events, err := h.OrderService.History(r.Context(), u.ID, chi.URLParam(r, "number"))
+	switch {
+	case errors.Is(err, service.ErrOrderNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		logger.L.Debug("unable to get order history", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]schemas.OrderEventResponse, 0, len(events))
+	for _, e := range events {
+		event := schemas.OrderEventResponse{
+			To:        string(e.To),
+			Accrual:   e.Accrual,
+			Source:    e.Source,
+			CreatedAt: e.CreatedAt,
+		}
+		if e.From != nil {
+			from := string(*e.From)
+			event.From = &from
+		}
+		resp = append(resp, event)
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func orderResponse(o *models.Order) schemas.OrderResponse {
+	return schemas.OrderResponse{
+		Number:     o.Number,
+		Status:     string(o.Status),
+		Accrual:    o.Accrual,
+		UploadedAt: o.UploadedAt,
+	}
+}
+
+func userFromContext(r *http.Request) (*models.User, bool) {
+	u, ok := r.Context().Value(contextkeys.UserKey).(*models.User)
+	return u, ok
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		logger.L.Debug("unable to encode response", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if _, err := w.Write(body); err != nil {
+		logger.L.Debug("unable to write response", zap.Error(err))
+	}
+}
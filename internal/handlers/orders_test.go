@@ -0,0 +1,427 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/rshafikov/gophermart/internal/accrual"
+	"github.com/rshafikov/gophermart/internal/core"
+	"github.com/rshafikov/gophermart/internal/core/contextkeys"
+	"github.com/rshafikov/gophermart/internal/models"
+	"github.com/rshafikov/gophermart/internal/repository"
+	"github.com/rshafikov/gophermart/internal/schemas"
+	"github.com/rshafikov/gophermart/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withUser stands in for middlewares.Authenticater, taking the user ID from
+// the X-User-ID test header.
+func withUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u := &models.User{ID: 1, Login: "user_1", Role: models.RoleUser}
+		if r.Header.Get("X-User-ID") == "2" {
+			u = &models.User{ID: 2, Login: "user_2", Role: models.RoleUser}
+		}
+		ctx := context.WithValue(r.Context(), contextkeys.UserKey, u)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func textRequest(t *testing.T, c *core.HTTPClient, method, path, body, userID string) (*http.Response, string) {
+	req, err := http.NewRequest(method, c.BaseURL+path, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("X-User-ID", userID)
+
+	resp, err := c.Client.Do(req)
+	require.NoError(t, err)
+
+	respBody, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	return resp, string(respBody)
+}
+
+func TestOrderHandler_CreateOrder(t *testing.T) {
+	orderService := service.NewOrderService(repository.NewMockOrderRepository())
+	handler := NewOrderHandler(orderService)
+	apiOrdersPath := "/api/user/orders"
+
+	r := chi.NewRouter()
+	r.Use(withUser)
+	r.Post(apiOrdersPath, handler.CreateOrder)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	tests := []struct {
+		name   string
+		body   string
+		userID string
+		code   int
+	}{
+		{name: "new order", body: "12345678903", userID: "1", code: http.StatusAccepted},
+		{name: "same order same user", body: "12345678903", userID: "1", code: http.StatusOK},
+		{name: "same order another user", body: "12345678903", userID: "2", code: http.StatusConflict},
+		{name: "invalid luhn", body: "12345678904", userID: "1", code: http.StatusUnprocessableEntity},
+		{name: "not a number", body: "order-1", userID: "1", code: http.StatusUnprocessableEntity},
+		{name: "empty body", body: "", userID: "1", code: http.StatusBadRequest},
+	}
+
+	var notCompress bool
+	client := core.NewHTTPClient(ts.URL, notCompress)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, _ := textRequest(t, client, http.MethodPost, apiOrdersPath, test.body, test.userID)
+			defer resp.Body.Close()
+
+			assert.Equal(t, test.code, resp.StatusCode)
+		})
+	}
+}
+
+func TestOrderHandler_ListOrders(t *testing.T) {
+	orderRepo := repository.NewMockOrderRepository()
+	orderService := service.NewOrderService(orderRepo)
+	handler := NewOrderHandler(orderService)
+	apiOrdersPath := "/api/user/orders"
+
+	r := chi.NewRouter()
+	r.Use(withUser)
+	r.Get(apiOrdersPath, handler.ListOrders)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	var notCompress bool
+	client := core.NewHTTPClient(ts.URL, notCompress)
+
+	resp, _ := client.URLRequest(t, http.MethodGet, apiOrdersPath)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	ctx := context.TODO()
+	require.NoError(t, orderService.Upload(ctx, 1, "12345678903"))
+	require.NoError(t, orderService.Upload(ctx, 1, "9278923470"))
+	require.NoError(t, orderService.Upload(ctx, 2, "346436439"))
+	amount := 500.0
+	require.NoError(t, orderRepo.UpdateStatus(ctx, "12345678903", models.OrderStatusNew, models.OrderStatusProcessed, &amount, service.SourcePoll))
+
+	resp, body := client.URLRequest(t, http.MethodGet, apiOrdersPath)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Contains(t, body, `"number":"9278923470","status":"NEW","uploaded_at"`)
+	assert.Contains(t, body, `"number":"12345678903","status":"PROCESSED","accrual":500`)
+	assert.NotContains(t, body, "346436439")
+	assert.Less(t, strings.Index(body, "9278923470"), strings.Index(body, "12345678903"), "newest first")
+}
+
+func TestOrderHandler_OrderHistory(t *testing.T) {
+	orderService := service.NewOrderService(repository.NewMockOrderRepository())
+	handler := NewOrderHandler(orderService)
+
+	r := chi.NewRouter()
+	r.Use(withUser)
+	r.Get("/api/user/orders/{number}/history", handler.OrderHistory)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	ctx := context.TODO()
+	amount := 729.98
+	require.NoError(t, orderService.Upload(ctx, 1, "12345678903"))
+	require.NoError(t, orderService.ApplyAccrual(ctx, service.SourcePoll, &accrual.OrderAccrual{Order: "12345678903", Status: accrual.StatusProcessing}))
+	require.NoError(t, orderService.ApplyAccrual(ctx, service.SourcePush, &accrual.OrderAccrual{Order: "12345678903", Status: accrual.StatusProcessed, Accrual: &amount}))
+	assert.ErrorIs(t, orderService.ApplyAccrual(ctx, service.SourcePoll, &accrual.OrderAccrual{Order: "12345678903", Status: accrual.StatusInvalid}), service.ErrOrderFinalized)
+
+	var notCompress bool
+	client := core.NewHTTPClient(ts.URL, notCompress)
+
+	tests := []struct {
+		name   string
+		number string
+		userID string
+		code   int
+	}{
+		{name: "owner", number: "12345678903", userID: "1", code: http.StatusOK},
+		{name: "another user", number: "12345678903", userID: "2", code: http.StatusNotFound},
+		{name: "unknown order", number: "9278923470", userID: "1", code: http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, _ := textRequest(t, client, http.MethodGet, "/api/user/orders/"+test.number+"/history", "", test.userID)
+			defer resp.Body.Close()
+			assert.Equal(t, test.code, resp.StatusCode)
+		})
+	}
+
+	resp, body := textRequest(t, client, http.MethodGet, "/api/user/orders/12345678903/history", "", "1")
+	defer resp.Body.Close()
+
+	var events []schemas.OrderEventResponse
+	require.NoError(t, json.Unmarshal([]byte(body), &events))
+	require.Len(t, events, 3, "rejected transitions are not recorded")
+
+	assert.Nil(t, events[0].From)
+	assert.Equal(t, "NEW", events[0].To)
+	assert.Equal(t, service.SourceUpload, events[0].Source)
+
+	assert.Equal(t, "NEW", *events[1].From)
+	assert.Equal(t, "PROCESSING", events[1].To)
+	assert.Equal(t, service.SourcePoll, events[1].Source)
+
+	assert.Equal(t, "PROCESSING", *events[2].From)
+	assert.Equal(t, "PROCESSED", events[2].To)
+	assert.Equal(t, service.SourcePush, events[2].Source)
+	require.NotNil(t, events[2].Accrual)
+	assert.Equal(t, amount, *events[2].Accrual)
+}
+
+func TestOrderHandler_GetOrder(t *testing.T) {
+	orderRepo := repository.NewMockOrderRepository()
+	orderService := service.NewOrderService(orderRepo)
+	accrualClient := accrual.NewMockClient()
+	orderService.AccrualClient = accrualClient
+	handler := NewOrderHandler(orderService)
+
+	r := chi.NewRouter()
+	r.Use(withUser)
+	r.Get("/api/user/orders/{number}", handler.GetOrder)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	ctx := context.TODO()
+	require.NoError(t, orderService.Upload(ctx, 1, "12345678903"))
+	require.NoError(t, orderService.Upload(ctx, 1, "9278923470"))
+	amount := 320.0
+	accrualClient.Set("12345678903", accrual.StatusProcessed, &amount)
+
+	var notCompress bool
+	client := core.NewHTTPClient(ts.URL, notCompress)
+
+	tests := []struct {
+		name   string
+		path   string
+		userID string
+		code   int
+		status string
+	}{
+		{name: "owner", path: "/12345678903", userID: "1", code: http.StatusOK, status: "NEW"},
+		{name: "another user", path: "/12345678903", userID: "2", code: http.StatusNotFound},
+		{name: "another user cannot refresh", path: "/12345678903?refresh=true", userID: "2", code: http.StatusNotFound},
+		{name: "unknown order", path: "/346436439", userID: "1", code: http.StatusNotFound},
+		{name: "invalid refresh", path: "/12345678903?refresh=yes", userID: "1", code: http.StatusBadRequest},
+		{name: "refresh", path: "/12345678903?refresh=true", userID: "1", code: http.StatusOK, status: "PROCESSED"},
+		{name: "refresh of order unknown to accrual", path: "/9278923470?refresh=1", userID: "1", code: http.StatusOK, status: "NEW"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, body := textRequest(t, client, http.MethodGet, "/api/user/orders"+test.path, "", test.userID)
+			defer resp.Body.Close()
+
+			require.Equal(t, test.code, resp.StatusCode)
+			if test.code != http.StatusOK {
+				assert.NotContains(t, body, "12345678903")
+				return
+			}
+
+			var order schemas.OrderDetailResponse
+			require.NoError(t, json.Unmarshal([]byte(body), &order))
+			assert.Equal(t, test.status, order.Status)
+			assert.False(t, order.UploadedAt.IsZero())
+			assert.False(t, order.UpdatedAt.IsZero())
+		})
+	}
+
+	assert.Equal(t, 2, accrualClient.Calls, "only refreshes of own orders reach the accrual system")
+	assert.Len(t, orderRepo.Ledger.Credits("12345678903"), 1)
+
+	resp, _ := textRequest(t, client, http.MethodGet, "/api/user/orders/12345678903?refresh=true", "", "1")
+	resp.Body.Close()
+	assert.Equal(t, 2, accrualClient.Calls, "final orders are not refreshed")
+}
+
+func TestOrderHandler_ListOrdersPaginated(t *testing.T) {
+	orderRepo := repository.NewMockOrderRepository()
+	orderService := service.NewOrderService(orderRepo)
+	handler := NewOrderHandler(orderService)
+
+	r := chi.NewRouter()
+	r.Use(withUser)
+	r.Get("/api/user/orders", handler.ListOrders)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	ctx := context.TODO()
+	numbers := []string{"12345678903", "9278923470", "346436439", "2377225624", "4561261212345467"}
+	for _, number := range numbers {
+		require.NoError(t, orderService.Upload(ctx, 1, number))
+	}
+	amount := 10.0
+	require.NoError(t, orderService.ApplyAccrual(ctx, service.SourcePoll, &accrual.OrderAccrual{Order: "346436439", Status: accrual.StatusProcessed, Accrual: &amount}))
+	require.NoError(t, orderService.ApplyAccrual(ctx, service.SourcePoll, &accrual.OrderAccrual{Order: "9278923470", Status: accrual.StatusInvalid}))
+
+	var notCompress bool
+	client := core.NewHTTPClient(ts.URL, notCompress)
+
+	list := func(t *testing.T, query string) (*http.Response, []schemas.OrderResponse) {
+		resp, body := textRequest(t, client, http.MethodGet, "/api/user/orders"+query, "", "1")
+		resp.Body.Close()
+		var orders []schemas.OrderResponse
+		if resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.Unmarshal([]byte(body), &orders))
+		}
+		return resp, orders
+	}
+
+	t.Run("walk all pages", func(t *testing.T) {
+		var got []string
+		query := "?limit=2"
+		for pages := 0; query != ""; pages++ {
+			require.Less(t, pages, 5)
+			resp, orders := list(t, query)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			for _, o := range orders {
+				got = append(got, o.Number)
+			}
+
+			query = ""
+			if cursor := resp.Header.Get("X-Next-Cursor"); cursor != "" {
+				assert.Equal(t, `</api/user/orders?cursor=`+cursor+`&limit=2>; rel="next"`, resp.Header.Get("Link"))
+				query = "?limit=2&cursor=" + cursor
+			}
+		}
+		assert.Equal(t, []string{"4561261212345467", "2377225624", "346436439", "9278923470", "12345678903"}, got)
+	})
+
+	t.Run("status filter", func(t *testing.T) {
+		resp, orders := list(t, "?status=processed,invalid")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Len(t, orders, 2)
+		assert.Equal(t, "346436439", orders[0].Number)
+		assert.Equal(t, "9278923470", orders[1].Number)
+		assert.Empty(t, resp.Header.Get("Link"))
+	})
+
+	t.Run("date range", func(t *testing.T) {
+		third, err := orderRepo.GetByNumber(ctx, "346436439")
+		require.NoError(t, err)
+		from := third.UploadedAt.Truncate(time.Second).Format(time.RFC3339)
+		to := third.UploadedAt.Add(time.Hour).Format(time.RFC3339)
+
+		resp, orders := list(t, "?from="+url.QueryEscape(from)+"&to="+url.QueryEscape(to))
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.NotEmpty(t, orders)
+
+		before := third.UploadedAt.Add(-time.Hour).Format(time.RFC3339)
+		resp, orders = list(t, "?to="+url.QueryEscape(before))
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "paginated listings answer 200 even when empty")
+		assert.Empty(t, orders)
+	})
+
+	t.Run("invalid parameters", func(t *testing.T) {
+		for _, query := range []string{"?limit=0", "?limit=101", "?cursor=bogus", "?from=yesterday", "?status=DONE",
+			"?from=2025-01-02T00:00:00Z&to=2025-01-01T00:00:00Z"} {
+			resp, _ := list(t, query)
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, query)
+		}
+	})
+
+	t.Run("spec compatible without parameters", func(t *testing.T) {
+		resp, orders := list(t, "")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Len(t, orders, len(numbers))
+		assert.Empty(t, resp.Header.Get("Link"))
+	})
+}
+
+func TestOrderHandler_CreateOrderBatch(t *testing.T) {
+	orderRepo := repository.NewMockOrderRepository()
+	orderService := service.NewOrderService(orderRepo)
+	handler := NewOrderHandler(orderService)
+	batchPath := "/api/user/orders/batch"
+
+	r := chi.NewRouter()
+	r.Use(withUser)
+	r.Post(batchPath, handler.CreateOrderBatch)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	ctx := context.TODO()
+	require.NoError(t, orderService.Upload(ctx, 1, "9278923470"))
+	require.NoError(t, orderService.Upload(ctx, 2, "346436439"))
+
+	var notCompress bool
+	client := core.NewHTTPClient(ts.URL, notCompress)
+
+	post := func(t *testing.T, contentType, body string) (*http.Response, string) {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+batchPath, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("X-User-ID", "1")
+
+		resp, err := client.Client.Do(req)
+		require.NoError(t, err)
+		respBody, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp, string(respBody)
+	}
+
+	want := `[
+		{"number":"12345678903","result":"accepted"},
+		{"number":"9278923470","result":"already_uploaded"},
+		{"number":"346436439","result":"conflict"},
+		{"number":"1234","result":"invalid"},
+		{"number":"12345678903","result":"already_uploaded"},
+		{"number":"346436439","result":"conflict"}
+	]`
+
+	t.Run("json", func(t *testing.T) {
+		resp, body := post(t, "application/json",
+			`["12345678903", "9278923470", "346436439", "1234", "12345678903", "346436439"]`)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.JSONEq(t, want, body)
+	})
+
+	t.Run("text", func(t *testing.T) {
+		resp, body := post(t, "text/plain; charset=utf-8", "2377225624\n\n 4561261212345467 \r\n2377225624\n")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.JSONEq(t, `[
+			{"number":"2377225624","result":"accepted"},
+			{"number":"4561261212345467","result":"accepted"},
+			{"number":"2377225624","result":"already_uploaded"}
+		]`, body)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		resp, _ := post(t, "text/plain", "\n\n")
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+		resp, _ := post(t, "application/json", `{"orders":[]}`)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("too many numbers", func(t *testing.T) {
+		resp, _ := post(t, "text/plain", strings.Repeat("12345678903\n", maxBatchOrders+1))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	})
+
+	orders, _, err := orderService.ListByUser(ctx, 1, models.OrderQuery{})
+	require.NoError(t, err)
+	assert.Len(t, orders, 4)
+	_, queued := orderRepo.Jobs.Get("4561261212345467")
+	assert.True(t, queued, "accepted orders are queued for accrual checks")
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/rshafikov/gophermart/internal/models"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 100
+)
+
+var errInvalidListQuery = errors.New("invalid listing query")
+
+// parsePageQuery reads the limit, cursor, from and to parameters of a
+// listing. Pagination is opt-in: paginated is false when none of them nor
+// any of the filters is given, and the whole listing is returned then.
+func parsePageQuery(r *http.Request, filters ...string) (q models.PageQuery, paginated bool, err error) {
+	values := r.URL.Query()
+	for _, name := range append([]string{"limit", "cursor", "from", "to"}, filters...) {
+		if values.Has(name) {
+			paginated = true
+		}
+	}
+	if !paginated {
+		return q, false, nil
+	}
+
+	q.Limit = defaultPageLimit
+	if v := values.Get("limit"); v != "" {
+		q.Limit, err = strconv.Atoi(v)
+		if err != nil || q.Limit < 1 || q.Limit > maxPageLimit {
+			return q, true, fmt.Errorf("%w: limit must be between 1 and %d", errInvalidListQuery, maxPageLimit)
+		}
+	}
+	if v := values.Get("cursor"); v != "" {
+		if q.After, err = models.DecodePageCursor(v); err != nil {
+			return q, true, fmt.Errorf("%w: %w", errInvalidListQuery, err)
+		}
+	}
+	if q.From, err = parseTimeParam(values.Get("from")); err != nil {
+		return q, true, fmt.Errorf("%w: from must be an RFC3339 time", errInvalidListQuery)
+	}
+	if q.To, err = parseTimeParam(values.Get("to")); err != nil {
+		return q, true, fmt.Errorf("%w: to must be an RFC3339 time", errInvalidListQuery)
+	}
+	if q.From != nil && q.To != nil && !q.From.Before(*q.To) {
+		return q, true, fmt.Errorf("%w: from must be before to", errInvalidListQuery)
+	}
+	return q, true, nil
+}
+
+func parseTimeParam(v string) (*time.Time, error) {
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// setNextPage advertises the next page in the Link and X-Next-Cursor headers.
+func setNextPage(w http.ResponseWriter, r *http.Request, next *models.PageCursor) {
+	if next == nil {
+		return
+	}
+	cursor := next.Encode()
+
+	u := *r.URL
+	values := u.Query()
+	values.Set("cursor", cursor)
+	u.RawQuery = values.Encode()
+
+	w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, u.RequestURI()))
+	w.Header().Set("X-Next-Cursor", cursor)
+}
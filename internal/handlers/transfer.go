@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/rshafikov/gophermart/internal/core/logger"
+	"github.com/rshafikov/gophermart/internal/models"
+	"github.com/rshafikov/gophermart/internal/schemas"
+	"github.com/rshafikov/gophermart/internal/service"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+type TransferHandler struct {
+	TransferService *service.TransferService
+}
+
+func NewTransferHandler(transferService *service.TransferService) *TransferHandler {
+	return &TransferHandler{TransferService: transferService}
+}
+
+func (h *TransferHandler) Transfer(w http.ResponseWriter, r *http.Request) {
+	u, ok := userFromContext(r)
+	if !ok {
+		logger.L.Debug("user not found in context")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	var req schemas.TransferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.L.Debug("unable to decode request body", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	t, err := h.TransferService.Transfer(r.Context(), u.ID, req.Recipient, req.Amount)
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, transferResponse(t, u.ID))
+	case errors.Is(err, service.ErrInsufficientFunds):
+		http.Error(w, err.Error(), http.StatusPaymentRequired)
+	case errors.Is(err, service.ErrRecipientNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidSum), errors.Is(err, service.ErrTransferTooSmall), errors.Is(err, service.ErrSelfTransfer):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, service.ErrTransferLimitExceeded):
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+	default:
+		logger.L.Debug("unable to transfer points", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *TransferHandler) ListTransfers(w http.ResponseWriter, r *http.Request) {
+	u, ok := userFromContext(r)
+	if !ok {
+		logger.L.Debug("user not found in context")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	q, paginated, err := parsePageQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	transfers, next, err := h.TransferService.ListByUser(r.Context(), u.ID, q)
+	if err != nil {
+		logger.L.Debug("unable to list transfers", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(transfers) == 0 && !paginated {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	resp := make([]schemas.TransferResponse, 0, len(transfers))
+	for _, t := range transfers {
+		resp = append(resp, transferResponse(t, u.ID))
+	}
+
+	setNextPage(w, r, next)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func transferResponse(t *models.Transfer, userID int) schemas.TransferResponse {
+	resp := schemas.TransferResponse{
+		ID:          t.ID,
+		Direction:   schemas.TransferSent,
+		Counterpart: t.RecipientLogin,
+		Amount:      t.Amount,
+		CreatedAt:   t.CreatedAt,
+	}
+	if t.RecipientID == userID {
+		resp.Direction = schemas.TransferReceived
+		resp.Counterpart = t.SenderLogin
+	}
+	return resp
+}
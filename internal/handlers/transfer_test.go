@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"github.com/go-chi/chi/v5"
+	"github.com/rshafikov/gophermart/internal/accrual"
+	"github.com/rshafikov/gophermart/internal/core"
+	"github.com/rshafikov/gophermart/internal/repository"
+	"github.com/rshafikov/gophermart/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTransferHandler_Transfer(t *testing.T) {
+	orderRepo := repository.NewMockOrderRepository()
+	orderService := service.NewOrderService(orderRepo)
+	transfers := repository.NewMockTransferRepository(orderRepo.Ledger)
+	transfers.Users = map[string]int{"user_1": 1, "user_2": 2}
+	handler := NewTransferHandler(service.NewTransferService(transfers, service.TransferLimits{MinAmount: 1, DailyMax: 300}))
+	balanceHandler := NewBalanceHandler(service.NewBalanceService(orderRepo.Ledger, repository.NewMockWithdrawalRepository(orderRepo.Ledger), orderRepo))
+
+	r := chi.NewRouter()
+	r.Use(withUser)
+	r.Post("/api/user/balance/transfer", handler.Transfer)
+	r.Get("/api/user/transfers", handler.ListTransfers)
+	r.Get("/api/user/balance", balanceHandler.GetBalance)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	ctx := context.TODO()
+	amount := 500.0
+	require.NoError(t, orderService.Upload(ctx, 1, "12345678903"))
+	require.NoError(t, orderService.ApplyAccrual(ctx, service.SourcePoll, &accrual.OrderAccrual{Order: "12345678903", Status: accrual.StatusProcessed, Accrual: &amount}))
+
+	var notCompress bool
+	client := core.NewHTTPClient(ts.URL, notCompress)
+
+	resp, _ := textRequest(t, client, http.MethodGet, "/api/user/transfers", "", "2")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	tests := []struct {
+		name   string
+		userID string
+		body   string
+		code   int
+	}{
+		{name: "success", userID: "1", body: `{"recipient":"user_2","amount":200}`, code: http.StatusOK},
+		{name: "unknown recipient", userID: "1", body: `{"recipient":"user_3","amount":10}`, code: http.StatusNotFound},
+		{name: "to yourself", userID: "1", body: `{"recipient":"user_1","amount":10}`, code: http.StatusUnprocessableEntity},
+		{name: "below minimum", userID: "1", body: `{"recipient":"user_2","amount":0.5}`, code: http.StatusUnprocessableEntity},
+		{name: "fractional cents", userID: "1", body: `{"recipient":"user_2","amount":1.005}`, code: http.StatusUnprocessableEntity},
+		{name: "daily limit", userID: "1", body: `{"recipient":"user_2","amount":100.01}`, code: http.StatusTooManyRequests},
+		{name: "insufficient funds", userID: "2", body: `{"recipient":"user_1","amount":200.01}`, code: http.StatusPaymentRequired},
+		{name: "invalid json", userID: "1", body: `{"recipient":`, code: http.StatusBadRequest},
+		{name: "gift back", userID: "2", body: `{"recipient":"user_1","amount":50}`, code: http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, _ := textRequest(t, client, http.MethodPost, "/api/user/balance/transfer", test.body, test.userID)
+			defer resp.Body.Close()
+			assert.Equal(t, test.code, resp.StatusCode)
+		})
+	}
+
+	resp, body := textRequest(t, client, http.MethodGet, "/api/user/balance", "", "1")
+	resp.Body.Close()
+	assert.JSONEq(t, `{"current":350,"withdrawn":0}`, body)
+	resp, body = textRequest(t, client, http.MethodGet, "/api/user/balance", "", "2")
+	resp.Body.Close()
+	assert.JSONEq(t, `{"current":150,"withdrawn":0}`, body)
+
+	resp, body = textRequest(t, client, http.MethodGet, "/api/user/transfers", "", "2")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, `"direction":"sent","counterpart":"user_1","amount":50`)
+	assert.Contains(t, body, `"direction":"received","counterpart":"user_1","amount":200`)
+}
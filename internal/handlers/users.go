@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/rshafikov/gophermart/internal/core/contextkeys"
 	"github.com/rshafikov/gophermart/internal/core/logger"
 	"github.com/rshafikov/gophermart/internal/core/security"
 	"github.com/rshafikov/gophermart/internal/models"
@@ -39,6 +38,10 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := h.UserService.Register(ctx, reqUser.Login, reqUser.Password); err != nil {
+		if errors.Is(err, service.ErrInvalidLogin) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		if errors.Is(err, service.ErrUserAlreadyExists) {
 			logger.L.Debug("user already exists", zap.String("login", reqUser.Login))
 			http.Error(w, err.Error(), http.StatusConflict)
@@ -50,7 +53,7 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	jwt, err := h.JWT.GenerateJWT(reqUser.Login)
+	jwt, err := h.JWT.GenerateJWT(reqUser.Login, string(models.RoleUser))
 	if err != nil {
 		logger.L.Debug("unable to generate JWT", zap.Error(err))
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -77,7 +80,7 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	jwt, err := h.JWT.GenerateJWT(user.Login)
+	jwt, err := h.JWT.GenerateJWT(user.Login, string(user.Role))
 	if err != nil {
 		logger.L.Debug("unable to generate JWT", zap.Error(err))
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -110,19 +113,3 @@ func (h *UserHandler) ValidateUserCredentials(login string, password string) err
 	}
 	return nil
 }
-
-func (h *UserHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
-	u, ok := r.Context().Value(contextkeys.UserKey).(*models.User)
-	if !ok {
-		logger.L.Debug("user not found in context")
-		http.Error(w, "internal error", http.StatusInternalServerError)
-		return
-	}
-
-	_, err := w.Write([]byte(u.Login))
-	if err != nil {
-		logger.L.Debug("unable to write response", zap.Error(err))
-		http.Error(w, "internal error", http.StatusInternalServerError)
-		return
-	}
-}
@@ -8,7 +8,9 @@ import (
 	"github.com/rshafikov/gophermart/internal/models"
 	"go.uber.org/zap"
 	"net/http"
+	"slices"
 	"strings"
+	"time"
 )
 
 func Authenticater(jwtHandler security.JWTHandler, userService models.UserService) func(next http.Handler) http.Handler {
@@ -27,12 +29,32 @@ func Authenticater(jwtHandler security.JWTHandler, userService models.UserServic
 				return
 			}
 
-			u, err := userService.GetByLogin(context.TODO(), payload.Subject)
+			u, err := userService.GetByLogin(r.Context(), payload.Subject)
 			if err != nil {
 				http.Error(w, "unauthorized", http.StatusUnauthorized)
 				return
 			}
 
+			// A deleted account frees its login, so a token issued before the
+			// current account with that login was created is someone else's.
+			// Token times are truncated to seconds.
+			if payload.IssuedAt != nil && payload.IssuedAt.Before(u.CreatedAt.Truncate(time.Second)) {
+				logger.L.Debug("token predates the user", zap.String("user", u.Login))
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			// Tokens issued before a role change are no longer valid.
+			role := models.Role(payload.Role)
+			if role == "" {
+				role = models.RoleUser
+			}
+			if role != u.Role {
+				logger.L.Debug("token role is outdated", zap.String("user", u.Login))
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
 			logger.L.Debug("user authenticated", zap.String("user", u.Login))
 			ctx := context.WithValue(r.Context(), contextkeys.UserKey, u)
 			next.ServeHTTP(w, r.WithContext(ctx))
@@ -40,3 +62,24 @@ func Authenticater(jwtHandler security.JWTHandler, userService models.UserServic
 		return http.HandlerFunc(fn)
 	}
 }
+
+// RequireRole admits only authenticated users with one of the roles. It
+// must run after Authenticater.
+func RequireRole(roles ...models.Role) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			u, ok := r.Context().Value(contextkeys.UserKey).(*models.User)
+			if !ok {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if !slices.Contains(roles, u.Role) {
+				logger.L.Debug("access denied", zap.String("user", u.Login), zap.String("role", string(u.Role)))
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
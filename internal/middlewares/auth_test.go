@@ -17,6 +17,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 func testHandler(w http.ResponseWriter, r *http.Request) {
@@ -67,6 +68,14 @@ func TestAuthenticater(t *testing.T) {
 				response: "user_1",
 			},
 		},
+		{
+			name:  "test with outdated role",
+			token: "fake-token user_1:admin",
+			want: want{
+				code:     http.StatusUnauthorized,
+				response: "unauthorized",
+			},
+		},
 		{
 			name:  "test with invalid token",
 			token: "wrong-fake-token user_1",
@@ -97,3 +106,61 @@ func TestAuthenticater(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthenticater_TokenPredatesUser(t *testing.T) {
+	users := repository.NewMockUserRepository().(*repository.MockUserRepository)
+	users.DB["old_user"] = &models.User{ID: 1, Login: "old_user", Role: models.RoleUser, CreatedAt: time.Now().Add(-time.Hour)}
+	// The login was freed by a deleted account and registered again after
+	// the token below was issued.
+	users.DB["new_user"] = &models.User{ID: 2, Login: "new_user", Role: models.RoleUser, CreatedAt: time.Now().Add(2 * time.Second)}
+	jwtHandler := security.NewJWTHandler("secret", time.Hour)
+	h := Authenticater(jwtHandler, service.NewUserService(users))(http.HandlerFunc(testHandler))
+
+	tests := []struct {
+		login string
+		code  int
+	}{
+		{login: "old_user", code: http.StatusOK},
+		{login: "new_user", code: http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(test.login, func(t *testing.T) {
+			token, err := jwtHandler.GenerateJWT(test.login, string(models.RoleUser))
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+token.Token)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			assert.Equal(t, test.code, w.Code)
+		})
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	h := RequireRole(models.RoleSupport, models.RoleAdmin)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name string
+		user *models.User
+		code int
+	}{
+		{name: "support", user: &models.User{ID: 1, Role: models.RoleSupport}, code: http.StatusOK},
+		{name: "admin", user: &models.User{ID: 2, Role: models.RoleAdmin}, code: http.StatusOK},
+		{name: "user", user: &models.User{ID: 3, Role: models.RoleUser}, code: http.StatusForbidden},
+		{name: "anonymous", code: http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/admin/users/user_1", nil)
+			if test.user != nil {
+				req = req.WithContext(context.WithValue(req.Context(), contextkeys.UserKey, test.user))
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			assert.Equal(t, test.code, w.Code)
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/rshafikov/gophermart/internal/core/contextkeys"
+	"github.com/rshafikov/gophermart/internal/core/logger"
+	"github.com/rshafikov/gophermart/internal/models"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotentReplayedHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	maxIdempotentRequestBody  = 1 << 20
+	idempotencyInProgressWait = "1"
+	idempotencyLease          = time.Minute
+	idempotencyHandlerTimeout = 30 * time.Second
+	completeAttempts          = 3
+	completeRetryDelay        = 100 * time.Millisecond
+)
+
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *idempotencyRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *idempotencyRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// Idempotency makes authenticated mutating requests safe to retry. The first
+// response to a request with an Idempotency-Key header is stored per user and
+// key for ttl and replayed for retries. A retry with a different method, path
+// or body is rejected with 422, one arriving while the first request is still
+// being handled with 409. Server errors are not stored, so the request may be
+// retried. A response that was sent but could not be stored keeps the key
+// reserved, so a retry cannot run the request twice. A reservation whose
+// request did not complete within a short lease, because the server crashed
+// or could not store the response, may be taken over by a retry; the handler
+// runs with a deadline well within the lease so a slow request cannot outlive
+// its reservation. Requests without the header pass through.
+func Idempotency(repo models.IdempotencyRepository, ttl time.Duration) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			u, ok := r.Context().Value(contextkeys.UserKey).(*models.User)
+			if key == "" || !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				http.Error(w, "idempotency key is too long", http.StatusBadRequest)
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentRequestBody))
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					http.Error(w, "request body is too large", http.StatusRequestEntityTooLarge)
+					return
+				}
+				http.Error(w, "unable to read request body", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			rec := &models.IdempotencyRecord{
+				UserID:      u.ID,
+				Key:         key,
+				RequestHash: requestHash(r, body),
+				ExpiresAt:   time.Now().Add(ttl),
+			}
+			existing, err := repo.Reserve(r.Context(), rec, idempotencyLease)
+			if errors.Is(err, models.ErrIdempotencyKeyGone) {
+				w.Header().Set("Retry-After", idempotencyInProgressWait)
+				http.Error(w, "request with this idempotency key has just finished", http.StatusConflict)
+				return
+			}
+			if err != nil {
+				logger.L.Error("unable to reserve idempotency key", zap.Error(err))
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+			if existing != nil {
+				replay(w, existing, rec.RequestHash)
+				return
+			}
+
+			// The outcome is stored even if the client has gone away.
+			ctx := context.WithoutCancel(r.Context())
+			recorder := &idempotencyRecorder{ResponseWriter: w}
+			release := true
+			defer func() {
+				if release {
+					_ = repo.Release(ctx, rec)
+				}
+			}()
+
+			handlerCtx, cancel := context.WithTimeout(r.Context(), idempotencyHandlerTimeout)
+			defer cancel()
+			next.ServeHTTP(recorder, r.WithContext(handlerCtx))
+
+			if recorder.status == 0 {
+				recorder.status = http.StatusOK
+			}
+			if recorder.status >= http.StatusInternalServerError {
+				return
+			}
+			release = false
+			rec.StatusCode = recorder.status
+			rec.ContentType = w.Header().Get("Content-Type")
+			rec.Body = recorder.body.Bytes()
+			if err := complete(ctx, w, repo, rec); err != nil {
+				logger.L.Error("unable to store idempotent response", zap.Error(err))
+			}
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// complete stores the response, retrying on failure. The response is flushed
+// first so the client does not wait for the retries.
+func complete(ctx context.Context, w http.ResponseWriter, repo models.IdempotencyRepository, rec *models.IdempotencyRecord) error {
+	err := repo.Complete(ctx, rec)
+	if err == nil {
+		return nil
+	}
+	_ = http.NewResponseController(w).Flush()
+	for attempt := 1; attempt < completeAttempts && err != nil && !errors.Is(err, models.ErrIdempotencyLeaseLost); attempt++ {
+		time.Sleep(completeRetryDelay * time.Duration(attempt))
+		err = repo.Complete(ctx, rec)
+	}
+	return err
+}
+
+func replay(w http.ResponseWriter, existing *models.IdempotencyRecord, requestHash string) {
+	switch {
+	case existing.RequestHash != requestHash:
+		http.Error(w, "idempotency key was used for another request", http.StatusUnprocessableEntity)
+	case existing.StatusCode == 0:
+		w.Header().Set("Retry-After", idempotencyInProgressWait)
+		http.Error(w, "request with this idempotency key is in progress", http.StatusConflict)
+	default:
+		if existing.ContentType != "" {
+			w.Header().Set("Content-Type", existing.ContentType)
+		}
+		w.Header().Set(IdempotentReplayedHeader, "true")
+		w.WriteHeader(existing.StatusCode)
+		_, _ = w.Write(existing.Body)
+	}
+}
+
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
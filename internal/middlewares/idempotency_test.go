@@ -0,0 +1,197 @@
+package middlewares
+
+import (
+	"context"
+	"github.com/rshafikov/gophermart/internal/core/contextkeys"
+	"github.com/rshafikov/gophermart/internal/models"
+	"github.com/rshafikov/gophermart/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdempotency(t *testing.T) {
+	repo := repository.NewMockIdempotencyRepository()
+	calls := 0
+	status := http.StatusOK
+	h := Idempotency(repo, time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"call":` + strconv.Itoa(calls) + `}`))
+	}))
+	do := func(user *models.User, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), contextkeys.UserKey, user))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+	user := &models.User{ID: 1, Login: "user_1"}
+	other := &models.User{ID: 2, Login: "user_2"}
+
+	w := do(user, "key-1", `{"sum":1}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"call":1}`, w.Body.String())
+	assert.Empty(t, w.Header().Get(IdempotentReplayedHeader))
+
+	w = do(user, "key-1", `{"sum":1}`)
+	assert.Equal(t, http.StatusOK, w.Code, "replayed")
+	assert.Equal(t, `{"call":1}`, w.Body.String())
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equal(t, "true", w.Header().Get(IdempotentReplayedHeader))
+	assert.Equal(t, 1, calls)
+
+	w = do(user, "key-1", `{"sum":2}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code, "same key, different body")
+	assert.Equal(t, 1, calls)
+
+	w = do(other, "key-1", `{"sum":1}`)
+	assert.Equal(t, http.StatusOK, w.Code, "keys are per user")
+	assert.Equal(t, `{"call":2}`, w.Body.String())
+
+	do(user, "", `{"sum":1}`)
+	do(user, "", `{"sum":1}`)
+	assert.Equal(t, 4, calls, "requests without a key are not deduplicated")
+
+	// server errors are not stored
+	status = http.StatusInternalServerError
+	assert.Equal(t, http.StatusInternalServerError, do(user, "key-2", `{"sum":1}`).Code)
+	status = http.StatusPaymentRequired
+	assert.Equal(t, http.StatusPaymentRequired, do(user, "key-2", `{"sum":1}`).Code)
+	assert.Equal(t, http.StatusPaymentRequired, do(user, "key-2", `{"sum":1}`).Code)
+	assert.Equal(t, 6, calls)
+
+	// expired keys may be reused
+	repo.Now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	status = http.StatusOK
+	w = do(user, "key-1", `{"sum":2}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"call":7}`, w.Body.String())
+
+	assert.Equal(t, http.StatusBadRequest, do(user, strings.Repeat("k", maxIdempotencyKeyLength+1), "").Code)
+}
+
+func TestIdempotency_InProgress(t *testing.T) {
+	repo := repository.NewMockIdempotencyRepository()
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	h := Idempotency(repo, time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-finish
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/api/user/orders", strings.NewReader("12345678903"))
+		req.Header.Set(IdempotencyKeyHeader, "key")
+		return req.WithContext(context.WithValue(req.Context(), contextkeys.UserKey, &models.User{ID: 1}))
+	}
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, newRequest())
+		done <- w
+	}()
+	<-started
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newRequest())
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	close(finish)
+	require.Equal(t, http.StatusAccepted, (<-done).Code)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, newRequest())
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, "true", w.Header().Get(IdempotentReplayedHeader))
+}
+
+func TestIdempotency_CompleteFails(t *testing.T) {
+	repo := repository.NewMockIdempotencyRepository()
+	calls := 0
+	h := Idempotency(repo, time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusOK)
+	}))
+	do := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", strings.NewReader(`{"sum":1}`))
+		req.Header.Set(IdempotencyKeyHeader, key)
+		req = req.WithContext(context.WithValue(req.Context(), contextkeys.UserKey, &models.User{ID: 1}))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	// a transient failure is retried
+	repo.CompleteErrs = completeAttempts - 1
+	assert.Equal(t, http.StatusOK, do("key-1").Code)
+	w := do("key-1")
+	assert.Equal(t, "true", w.Header().Get(IdempotentReplayedHeader))
+	assert.Equal(t, 1, calls)
+
+	// the response was sent, so the key stays reserved
+	repo.CompleteErrs = completeAttempts
+	assert.Equal(t, http.StatusOK, do("key-2").Code)
+	assert.Equal(t, http.StatusConflict, do("key-2").Code)
+	assert.Equal(t, 2, calls)
+
+	// until its lease runs out
+	repo.Now = func() time.Time { return time.Now().Add(idempotencyLease) }
+	assert.Equal(t, http.StatusOK, do("key-2").Code)
+	assert.Equal(t, 3, calls)
+	w = do("key-2")
+	assert.Equal(t, "true", w.Header().Get(IdempotentReplayedHeader))
+	assert.Equal(t, 3, calls)
+}
+
+func TestIdempotency_LeaseLost(t *testing.T) {
+	repo := repository.NewMockIdempotencyRepository()
+	rec := &models.IdempotencyRecord{UserID: 1, Key: "key", RequestHash: "hash", ExpiresAt: time.Now().Add(time.Hour)}
+	existing, err := repo.Reserve(context.TODO(), rec, time.Minute)
+	require.NoError(t, err)
+	require.Nil(t, existing)
+
+	repo.Now = func() time.Time { return time.Now().Add(time.Minute) }
+	retry := *rec
+	existing, err = repo.Reserve(context.TODO(), &retry, time.Minute)
+	require.NoError(t, err)
+	require.Nil(t, existing, "the expired lease is taken over")
+
+	rec.StatusCode = http.StatusOK
+	assert.ErrorIs(t, repo.Complete(context.TODO(), rec), models.ErrIdempotencyLeaseLost)
+	assert.ErrorIs(t, repo.Release(context.TODO(), rec), models.ErrIdempotencyLeaseLost)
+	retry.StatusCode = http.StatusOK
+	assert.NoError(t, repo.Complete(context.TODO(), &retry))
+}
+
+func TestIdempotency_HandlerDeadline(t *testing.T) {
+	repo := repository.NewMockIdempotencyRepository()
+	var deadline time.Time
+	var hasDeadline bool
+	h := Idempotency(repo, time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline, hasDeadline = r.Context().Deadline()
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	start := time.Now()
+	req := httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", strings.NewReader(`{"sum":1}`))
+	req.Header.Set(IdempotencyKeyHeader, "key")
+	req = req.WithContext(context.WithValue(req.Context(), contextkeys.UserKey, &models.User{ID: 1}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	require.True(t, hasDeadline, "the handler is bounded")
+	assert.True(t, deadline.Before(start.Add(idempotencyLease)), "the handler finishes within the lease")
+}
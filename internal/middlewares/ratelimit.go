@@ -0,0 +1,206 @@
+package middlewares
+
+import (
+	"fmt"
+	"github.com/rshafikov/gophermart/internal/core/contextkeys"
+	"github.com/rshafikov/gophermart/internal/models"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const rateLimitSweepInterval = time.Minute
+
+type RateLimitConfig struct {
+	// Rate is the number of requests per second refilled into each bucket.
+	Rate float64
+	// Burst is the bucket capacity, i.e. the number of requests allowed at once.
+	Burst int
+	// TrustedProxies are the peers whose X-Forwarded-For header is honoured.
+	TrustedProxies []netip.Prefix
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter is a token-bucket limiter keyed on the authenticated user ID,
+// or on the client IP for anonymous requests.
+type RateLimiter struct {
+	cfg       RateLimitConfig
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewRateLimiter returns a limiter for cfg. A non-positive Burst defaults to
+// one second worth of requests.
+func NewRateLimiter(cfg RateLimitConfig) *RateLimiter {
+	if cfg.Burst < 1 {
+		cfg.Burst = max(1, int(math.Ceil(cfg.Rate)))
+	}
+	return &RateLimiter{
+		cfg:     cfg,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed, remaining, retryAfter, reset := l.take(l.key(r))
+
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(l.cfg.Burst))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(reset)))
+
+		if !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(retryAfter)))
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (l *RateLimiter) key(r *http.Request) string {
+	if u, ok := r.Context().Value(contextkeys.UserKey).(*models.User); ok {
+		return fmt.Sprintf("user:%d", u.ID)
+	}
+	return "ip:" + ClientIP(r, l.cfg.TrustedProxies)
+}
+
+// take consumes a token from the bucket identified by key. It reports whether
+// the request is allowed, how many whole tokens are left, how long to wait for
+// the next token and how long until the bucket is full again.
+func (l *RateLimiter) take(key string) (bool, int, time.Duration, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	capacity := float64(l.cfg.Burst)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*l.cfg.Rate)
+	b.last = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+
+	var retryAfter time.Duration
+	if !allowed {
+		retryAfter = l.refillTime(1 - b.tokens)
+	}
+
+	return allowed, int(b.tokens), retryAfter, l.refillTime(capacity - b.tokens)
+}
+
+func (l *RateLimiter) refillTime(tokens float64) time.Duration {
+	if l.cfg.Rate <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / l.cfg.Rate * float64(time.Second))
+}
+
+// sweep drops buckets that have been idle long enough to be full again,
+// so the map does not grow with every client ever seen.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	full := l.refillTime(float64(l.cfg.Burst))
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > full {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// ClientIP returns the address of the client that issued r. X-Forwarded-For is
+// only consulted when the direct peer is a trusted proxy; it is then walked
+// from right to left, skipping trusted hops.
+func ClientIP(r *http.Request, trusted []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	peer, err := netip.ParseAddr(host)
+	if err != nil || !isTrusted(peer, trusted) {
+		return host
+	}
+
+	client := host
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = addr.String()
+		if !isTrusted(addr, trusted) {
+			break
+		}
+	}
+
+	return client
+}
+
+func isTrusted(addr netip.Addr, trusted []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, p := range trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTrustedProxies parses a comma-separated list of IPs and CIDR ranges.
+func ParseTrustedProxies(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		if strings.Contains(item, "/") {
+			p, err := netip.ParsePrefix(item)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, p.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(item)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
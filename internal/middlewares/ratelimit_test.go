@@ -0,0 +1,90 @@
+package middlewares
+
+import (
+	"context"
+	"github.com/rshafikov/gophermart/internal/core/contextkeys"
+	"github.com/rshafikov/gophermart/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Middleware(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(RateLimitConfig{Rate: 1, Burst: 2})
+	limiter.now = func() time.Time { return now }
+
+	h := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	do := func(remoteAddr string, user *models.User) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		if user != nil {
+			req = req.WithContext(context.WithValue(req.Context(), contextkeys.UserKey, user))
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("10.0.0.1:1000", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("X-RateLimit-Remaining"))
+
+	w = do("10.0.0.1:1001", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "2", w.Header().Get("X-RateLimit-Reset"))
+
+	w = do("10.0.0.1:1002", nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	// another IP and an authenticated user have their own buckets
+	assert.Equal(t, http.StatusOK, do("10.0.0.2:1000", nil).Code)
+	user := &models.User{ID: 7, Login: "user_1"}
+	assert.Equal(t, http.StatusOK, do("10.0.0.1:1003", user).Code)
+	assert.Equal(t, http.StatusOK, do("10.0.0.3:1000", user).Code)
+	assert.Equal(t, http.StatusTooManyRequests, do("10.0.0.4:1000", user).Code)
+
+	now = now.Add(time.Second)
+	assert.Equal(t, http.StatusOK, do("10.0.0.1:1004", nil).Code)
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies("10.0.0.0/8, 192.168.1.1")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		want       string
+	}{
+		{name: "direct client", remoteAddr: "203.0.113.5:1234", want: "203.0.113.5"},
+		{name: "untrusted peer ignores header", remoteAddr: "203.0.113.5:1234", xff: "1.2.3.4", want: "203.0.113.5"},
+		{name: "trusted proxy", remoteAddr: "10.1.2.3:1234", xff: "1.2.3.4", want: "1.2.3.4"},
+		{name: "spoofed left entry", remoteAddr: "10.1.2.3:1234", xff: "6.6.6.6, 1.2.3.4, 192.168.1.1", want: "1.2.3.4"},
+		{name: "trusted proxy without header", remoteAddr: "10.1.2.3:1234", want: "10.1.2.3"},
+		{name: "ipv6 client", remoteAddr: "10.1.2.3:1234", xff: "2001:db8::1", want: "2001:db8::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			assert.Equal(t, tt.want, ClientIP(req, trusted))
+		})
+	}
+}
+
+func TestParseTrustedProxies_Invalid(t *testing.T) {
+	_, err := ParseTrustedProxies("10.0.0.0/8,not-an-ip")
+	assert.Error(t, err)
+}
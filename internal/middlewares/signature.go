@@ -0,0 +1,69 @@
+package middlewares
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/rshafikov/gophermart/internal/core/logger"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SignatureHeader = "X-Signature"
+	TimestampHeader = "X-Signature-Timestamp"
+	signaturePrefix = "sha256="
+	maxSignedBody   = 1 << 20
+)
+
+// Sign returns the X-Signature value for body sent at timestamp:
+// "sha256=" + hex(HMAC-SHA256(secret, "<unix timestamp>." + body)).
+func Sign(secret []byte, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignatureVerifier rejects requests whose body is not signed with secret or
+// whose timestamp is further than maxSkew from now, which bounds replays.
+func SignatureVerifier(secret []byte, maxSkew time.Duration) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			unix, err := strconv.ParseInt(r.Header.Get(TimestampHeader), 10, 64)
+			if err != nil {
+				http.Error(w, "invalid signature", http.StatusUnauthorized)
+				return
+			}
+			timestamp := time.Unix(unix, 0)
+			if skew := time.Since(timestamp).Abs(); skew > maxSkew {
+				logger.L.Debug("signature timestamp out of range", zap.Duration("skew", skew))
+				http.Error(w, "invalid signature", http.StatusUnauthorized)
+				return
+			}
+
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxSignedBody))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			signature := r.Header.Get(SignatureHeader)
+			if !strings.HasPrefix(signature, signaturePrefix) ||
+				!hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, body))) {
+				http.Error(w, "invalid signature", http.StatusUnauthorized)
+				return
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
@@ -0,0 +1,77 @@
+package middlewares
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSignatureVerifier(t *testing.T) {
+	secret := []byte("secret")
+	body := []byte(`{"order":"1","status":"PROCESSED"}`)
+
+	var got []byte
+	h := SignatureVerifier(secret, time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = io.ReadAll(r.Body)
+	}))
+
+	tests := []struct {
+		name      string
+		timestamp time.Time
+		signature func(ts time.Time) string
+		code      int
+	}{
+		{
+			name:      "valid",
+			timestamp: time.Now(),
+			signature: func(ts time.Time) string { return Sign(secret, ts, body) },
+			code:      http.StatusOK,
+		},
+		{
+			name:      "wrong secret",
+			timestamp: time.Now(),
+			signature: func(ts time.Time) string { return Sign([]byte("other"), ts, body) },
+			code:      http.StatusUnauthorized,
+		},
+		{
+			name:      "replayed with new timestamp",
+			timestamp: time.Now(),
+			signature: func(ts time.Time) string { return Sign(secret, ts.Add(-time.Hour), body) },
+			code:      http.StatusUnauthorized,
+		},
+		{
+			name:      "stale timestamp",
+			timestamp: time.Now().Add(-2 * time.Minute),
+			signature: func(ts time.Time) string { return Sign(secret, ts, body) },
+			code:      http.StatusUnauthorized,
+		},
+		{
+			name:      "missing signature",
+			timestamp: time.Now(),
+			signature: func(ts time.Time) string { return "" },
+			code:      http.StatusUnauthorized,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got = nil
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+			req.Header.Set(TimestampHeader, strconv.FormatInt(test.timestamp.Unix(), 10))
+			req.Header.Set(SignatureHeader, test.signature(test.timestamp))
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, req)
+
+			assert.Equal(t, test.code, w.Code)
+			if test.code == http.StatusOK {
+				assert.Equal(t, body, got, "body is passed on to the handler")
+			}
+		})
+	}
+}
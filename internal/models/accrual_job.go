@@ -0,0 +1,53 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrLeaseLost is returned when a job is updated after its lease expired and
+// another worker may have taken it.
+var ErrLeaseLost = errors.New("accrual job lease lost")
+
+type AccrualJobStatus string
+
+const (
+	AccrualJobPending AccrualJobStatus = "PENDING"
+	AccrualJobDone    AccrualJobStatus = "DONE"
+	// AccrualJobDead marks a job that failed too many times in a row. It is
+	// not leased again until re-enqueued.
+	AccrualJobDead AccrualJobStatus = "DEAD"
+)
+
+// AccrualJob is a scheduled accrual check of one order.
+type AccrualJob struct {
+	OrderNumber string
+	Status      AccrualJobStatus
+	// Attempts counts consecutive leases that did not end in a successful
+	// check, including ones abandoned by a crashed worker.
+	Attempts    int
+	NextRunAt   time.Time
+	LockedUntil *time.Time
+	LastError   *string
+}
+
+// AccrualJobQueue is a durable work queue of accrual checks shared by all
+// replicas. A leased job is invisible to other workers until its lease
+// expires; every method but Enqueue and Lease requires the lease to still
+// be held and returns ErrLeaseLost otherwise.
+type AccrualJobQueue interface {
+	Enqueue(ctx context.Context, orderNumber string) error
+	Lease(ctx context.Context, limit int, visibility time.Duration) ([]*AccrualJob, error)
+	// Complete finishes the job, the order has its final status.
+	Complete(ctx context.Context, job *AccrualJob) error
+	// Reschedule runs the job again at runAt after a successful check and
+	// resets its attempts.
+	Reschedule(ctx context.Context, job *AccrualJob, runAt time.Time) error
+	// Release gives the job back without counting the attempt.
+	Release(ctx context.Context, job *AccrualJob, runAt time.Time) error
+	// Retry runs the job again at runAt after a failed attempt.
+	Retry(ctx context.Context, job *AccrualJob, runAt time.Time, reason string) error
+	// Bury moves the job to the dead-letter state.
+	Bury(ctx context.Context, job *AccrualJob, reason string) error
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// AuditAction names what support staff did to a user.
+type AuditAction string
+
+const (
+	AuditAdjustment AuditAction = "ADJUSTMENT"
+	AuditRefund     AuditAction = "REFUND"
+	AuditRoleChange AuditAction = "ROLE_CHANGE"
+)
+
+// AuditEntry records an action of the actor on the account of the user. It
+// is written in the same transaction as the change it describes.
+type AuditEntry struct {
+	ID      int
+	ActorID int
+	Actor   string
+	UserID  int
+	User    string
+	Action  AuditAction
+	Reason  string
+	// Details holds action specific data, such as the adjusted amount.
+	Details   map[string]any
+	CreatedAt time.Time
+}
+
+type AuditQuery struct {
+	PageQuery
+	// ActorID and UserID keep only the entries of the actor and of the user.
+	ActorID *int
+	UserID  *int
+}
+
+type AuditRepository interface {
+	// List returns the entries matching the query, newest first.
+	List(ctx context.Context, q AuditQuery) ([]*AuditEntry, error)
+}
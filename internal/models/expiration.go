@@ -0,0 +1,126 @@
+package models
+
+import (
+	"math"
+	"slices"
+	"time"
+)
+
+// ExpiryPolicy makes credited points expire Months after they were credited.
+// Debits consume the oldest points first. A zero policy never expires points.
+type ExpiryPolicy struct {
+	Months int
+}
+
+func (p ExpiryPolicy) Enabled() bool {
+	return p.Months > 0
+}
+
+func (p ExpiryPolicy) ExpiresAt(credited time.Time) time.Time {
+	return credited.AddDate(0, p.Months, 0)
+}
+
+// CreditedBefore returns a time such that every credit expiring by now was
+// made before it.
+func (p ExpiryPolicy) CreditedBefore(now time.Time) time.Time {
+	return now.AddDate(0, -p.Months, 1)
+}
+
+// PointLot is what is left of a credit.
+type PointLot struct {
+	Amount    float64
+	ExpiresAt time.Time
+}
+
+// Lots replays the ledger entries of a user, oldest first, and returns what
+// is left of every credit. Debits consume the oldest points that had not
+// expired when they were made; expirations consume the points that had.
+func (p ExpiryPolicy) Lots(entries []*LedgerEntry) []PointLot {
+	var lots []PointLot
+	for _, e := range entries {
+		if e.Amount > 0 {
+			lots = append(lots, PointLot{Amount: e.Amount, ExpiresAt: p.ExpiresAt(e.CreatedAt)})
+			continue
+		}
+
+		left := -e.Amount
+		if e.Kind == LedgerExpiration {
+			left = consume(lots, left, func(l PointLot) bool { return !l.ExpiresAt.After(e.CreatedAt) })
+		} else {
+			left = consume(lots, left, func(l PointLot) bool { return l.ExpiresAt.After(e.CreatedAt) })
+		}
+		// Entries made before the policy was introduced may not fit it;
+		// they take whatever is left so that the lots add up to the balance.
+		consume(lots, left, func(PointLot) bool { return true })
+	}
+	return lots
+}
+
+func consume(lots []PointLot, amount float64, eligible func(PointLot) bool) float64 {
+	for i := range lots {
+		if amount <= 0 {
+			break
+		}
+		if lots[i].Amount <= 0 || !eligible(lots[i]) {
+			continue
+		}
+		taken := min(lots[i].Amount, amount)
+		lots[i].Amount = RoundPoints(lots[i].Amount - taken)
+		amount = RoundPoints(amount - taken)
+	}
+	return amount
+}
+
+// Expired returns the points of lots that have expired by now.
+func Expired(lots []PointLot, now time.Time) float64 {
+	var sum float64
+	for _, l := range lots {
+		if !l.ExpiresAt.After(now) {
+			sum += l.Amount
+		}
+	}
+	return RoundPoints(sum)
+}
+
+// Due returns the points of the entries that have expired by now and not
+// been written off yet. It never exceeds the balance.
+func (p ExpiryPolicy) Due(entries []*LedgerEntry, now time.Time) float64 {
+	if !p.Enabled() {
+		return 0
+	}
+	var balance float64
+	for _, e := range entries {
+		balance += e.Amount
+	}
+	return min(Expired(p.Lots(entries), now), RoundPoints(balance))
+}
+
+// Upcoming returns the points of lots that have not expired by now, summed
+// per UTC day, soonest first. Each day reports its earliest expiry.
+func Upcoming(lots []PointLot, now time.Time) []PointLot {
+	lots = slices.Clone(lots)
+	slices.SortStableFunc(lots, func(a, b PointLot) int { return a.ExpiresAt.Compare(b.ExpiresAt) })
+
+	var upcoming []PointLot
+	for _, l := range lots {
+		if l.Amount <= 0 || !l.ExpiresAt.After(now) {
+			continue
+		}
+		n := len(upcoming)
+		if n > 0 && sameDay(upcoming[n-1].ExpiresAt, l.ExpiresAt) {
+			upcoming[n-1].Amount = RoundPoints(upcoming[n-1].Amount + l.Amount)
+			continue
+		}
+		upcoming = append(upcoming, l)
+	}
+	return upcoming
+}
+
+// RoundPoints rounds to the cents stored by the ledger.
+func RoundPoints(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+func sameDay(a, b time.Time) bool {
+	return a.UTC().Truncate(24 * time.Hour).Equal(b.UTC().Truncate(24 * time.Hour))
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestExpiryPolicy_Lots(t *testing.T) {
+	policy := ExpiryPolicy{Months: 1}
+	day := func(d int) time.Time { return time.Date(2025, 1, d, 12, 0, 0, 0, time.UTC) }
+	entry := func(kind LedgerEntryKind, amount float64, at time.Time) *LedgerEntry {
+		return &LedgerEntry{Kind: kind, Amount: amount, CreatedAt: at}
+	}
+
+	tests := []struct {
+		name     string
+		entries  []*LedgerEntry
+		now      time.Time
+		expired  float64
+		upcoming []PointLot
+	}{
+		{
+			name:     "nothing expired yet",
+			entries:  []*LedgerEntry{entry(LedgerAccrual, 100, day(1))},
+			now:      day(31),
+			upcoming: []PointLot{{Amount: 100, ExpiresAt: day(32)}},
+		},
+		{
+			name: "withdrawals consume the oldest points first",
+			entries: []*LedgerEntry{
+				entry(LedgerAccrual, 100, day(1)),
+				entry(LedgerAccrual, 50, day(10)),
+				entry(LedgerWithdrawal, -120, day(20)),
+			},
+			now:      day(33),
+			upcoming: []PointLot{{Amount: 30, ExpiresAt: day(41)}},
+		},
+		{
+			name: "expired points are not withdrawn",
+			entries: []*LedgerEntry{
+				entry(LedgerAccrual, 100, day(1)),
+				entry(LedgerAccrual, 50, day(10)),
+				entry(LedgerWithdrawal, -20, day(35)),
+			},
+			now:      day(35),
+			expired:  100,
+			upcoming: []PointLot{{Amount: 30, ExpiresAt: day(41)}},
+		},
+		{
+			name: "points expire once",
+			entries: []*LedgerEntry{
+				entry(LedgerAccrual, 100, day(1)),
+				entry(LedgerAccrual, 50, day(10)),
+				entry(LedgerExpiration, -100, day(33)),
+			},
+			now:      day(42),
+			expired:  50,
+			upcoming: nil,
+		},
+		{
+			name: "same day credits are summed",
+			entries: []*LedgerEntry{
+				entry(LedgerAccrual, 0.1, day(1)),
+				entry(LedgerAccrual, 0.2, day(1).Add(time.Hour)),
+			},
+			now:      day(2),
+			upcoming: []PointLot{{Amount: 0.3, ExpiresAt: day(32)}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lots := policy.Lots(test.entries)
+			assert.Equal(t, test.expired, Expired(lots, test.now))
+			assert.Equal(t, test.upcoming, Upcoming(lots, test.now))
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrIdempotencyKeyGone = errors.New("idempotency key expired while being reserved")
+
+// ErrIdempotencyLeaseLost is returned when a record is updated after its
+// in-progress lease expired and another request reserved the key.
+var ErrIdempotencyLeaseLost = errors.New("idempotency key lease lost")
+
+// IdempotencyRecord is the stored response of the first request made with an
+// idempotency key.
+type IdempotencyRecord struct {
+	UserID      int
+	Key         string
+	RequestHash string
+	// StatusCode is 0 while the first request is still being handled.
+	StatusCode  int
+	ContentType string
+	Body        []byte
+	ExpiresAt   time.Time
+	// LockedUntil ends the lease of the request in progress; a retry may
+	// reserve the key again after it. It is nil once the response is stored.
+	LockedUntil *time.Time
+}
+
+type IdempotencyRepository interface {
+	// Reserve stores rec as in progress for lease and sets its LockedUntil.
+	// If a live record already exists for the user and key it is returned
+	// instead and rec is not stored.
+	Reserve(ctx context.Context, rec *IdempotencyRecord, lease time.Duration) (existing *IdempotencyRecord, err error)
+	// Complete stores the response of a reserved record. Complete and Release
+	// return ErrIdempotencyLeaseLost if rec no longer holds the key.
+	Complete(ctx context.Context, rec *IdempotencyRecord) error
+	// Release deletes the record so the request may be retried.
+	Release(ctx context.Context, rec *IdempotencyRecord) error
+	DeleteExpired(ctx context.Context) (int64, error)
+}
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+type LedgerEntryKind string
+
+const (
+	// LedgerAccrual credits the accrual of a processed order. There is at
+	// most one per order.
+	LedgerAccrual LedgerEntryKind = "ACCRUAL"
+	// LedgerWithdrawal debits a withdrawal.
+	LedgerWithdrawal LedgerEntryKind = "WITHDRAWAL"
+	// LedgerRefund credits back a refunded withdrawal. There is at most one
+	// per withdrawal.
+	LedgerRefund LedgerEntryKind = "REFUND"
+	// LedgerExpiration debits points that have expired, see ExpiryPolicy.
+	LedgerExpiration LedgerEntryKind = "EXPIRATION"
+	// LedgerTransferOut and LedgerTransferIn are the two sides of a Transfer.
+	LedgerTransferOut LedgerEntryKind = "TRANSFER_OUT"
+	LedgerTransferIn  LedgerEntryKind = "TRANSFER_IN"
+	// LedgerAdjustment is a manual correction made by support staff.
+	LedgerAdjustment LedgerEntryKind = "ADJUSTMENT"
+)
+
+var ledgerEntryKinds = []LedgerEntryKind{
+	LedgerAccrual, LedgerWithdrawal, LedgerRefund, LedgerExpiration, LedgerTransferOut, LedgerTransferIn, LedgerAdjustment,
+}
+
+func (k LedgerEntryKind) Valid() bool {
+	return slices.Contains(ledgerEntryKinds, k)
+}
+
+// LedgerEntry is a change of a user's balance; credits are positive and
+// debits negative. The balance is the sum of all entries.
+type LedgerEntry struct {
+	ID          int
+	UserID      int
+	Kind        LedgerEntryKind
+	Amount      float64
+	OrderNumber *string
+	TransferID  *int
+	// Reason explains an adjustment.
+	Reason    string
+	CreatedAt time.Time
+}
+
+// Transaction is a ledger entry as shown in the user's history.
+type Transaction struct {
+	LedgerEntry
+	// Balance is the user's balance right after the entry.
+	Balance float64
+	// Counterpart is the login of the other user of a transfer.
+	Counterpart *string
+}
+
+type TransactionQuery struct {
+	PageQuery
+	// Kinds keeps only entries of one of the kinds; empty keeps all.
+	Kinds []LedgerEntryKind
+}
+
+type Balance struct {
+	Current float64
+	// Withdrawn is the total spent on withdrawals that were not refunded.
+	Withdrawn float64
+	// Expiring lists the points that will expire, soonest first. It is
+	// only filled when points expire.
+	Expiring []PointLot
+}
+
+type LedgerRepository interface {
+	GetBalance(ctx context.Context, userID int) (*Balance, error)
+	// Adjust posts a manual adjustment and records audit. A debit returns
+	// ErrInsufficientFunds if the user's balance does not cover it.
+	Adjust(ctx context.Context, e *LedgerEntry, audit *AuditEntry) error
+	// ListTransactions returns the user's entries, newest first.
+	ListTransactions(ctx context.Context, userID int, q TransactionQuery) ([]*Transaction, error)
+	// ListEntries returns all entries of the user, oldest first.
+	ListEntries(ctx context.Context, userID int) ([]*LedgerEntry, error)
+	// ListUsersWithExpiredCredits returns the users with a positive balance
+	// and a credit that has expired by now under the policy but had not when
+	// their latest expiration was written off.
+	ListUsersWithExpiredCredits(ctx context.Context, policy ExpiryPolicy, now time.Time) ([]int, error)
+	// Expire debits the amount returned by due as an expiration made at the
+	// given time. due is called with the user's entries, oldest first, while
+	// their balance is locked against concurrent debits.
+	Expire(ctx context.Context, userID int, at time.Time, due func([]*LedgerEntry) float64) (float64, error)
+}
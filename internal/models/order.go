@@ -0,0 +1,108 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrOrderNotFound = errors.New("order not found")
+var ErrOrderExists = errors.New("order already exists")
+var ErrIllegalTransition = errors.New("illegal order status transition")
+var ErrOrderStatusChanged = errors.New("order status has changed concurrently")
+
+type OrderStatus string
+
+const (
+	OrderStatusNew        OrderStatus = "NEW"
+	OrderStatusProcessing OrderStatus = "PROCESSING"
+	OrderStatusInvalid    OrderStatus = "INVALID"
+	OrderStatusProcessed  OrderStatus = "PROCESSED"
+)
+
+// orderTransitions lists the statuses an order may move to. INVALID and
+// PROCESSED are final and have none.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusNew:        {OrderStatusProcessing, OrderStatusInvalid, OrderStatusProcessed},
+	OrderStatusProcessing: {OrderStatusInvalid, OrderStatusProcessed},
+}
+
+// IsFinal reports whether the order is done with accrual processing.
+func (s OrderStatus) IsFinal() bool {
+	return s == OrderStatusInvalid || s == OrderStatusProcessed
+}
+
+func (s OrderStatus) CanTransitionTo(to OrderStatus) bool {
+	for _, allowed := range orderTransitions[s] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateTransition returns ErrIllegalTransition if an order may not move
+// from one status to the other.
+func ValidateTransition(from, to OrderStatus) error {
+	if !from.CanTransitionTo(to) {
+		return fmt.Errorf("%w: %s -> %s", ErrIllegalTransition, from, to)
+	}
+	return nil
+}
+
+type Order struct {
+	ID         int
+	Number     string
+	UserID     int
+	Status     OrderStatus
+	Accrual    *float64
+	UploadedAt time.Time
+	UpdatedAt  time.Time
+}
+
+// PendingOrders counts a user's orders that still await their accrual.
+type PendingOrders struct {
+	New        int
+	Processing int
+}
+
+func (p PendingOrders) Total() int {
+	return p.New + p.Processing
+}
+
+// OrderEvent records a status change of an order. From is nil for the
+// event created with the order.
+type OrderEvent struct {
+	ID        int
+	OrderID   int
+	From      *OrderStatus
+	To        OrderStatus
+	Accrual   *float64
+	Source    string
+	CreatedAt time.Time
+}
+
+type OrderRepository interface {
+	// CreateOrder stores a new order with its first event and schedules its
+	// accrual check.
+	CreateOrder(ctx context.Context, order *Order, source string) error
+	// CreateOrders is CreateOrder for many orders at once. Orders whose
+	// number already exists are skipped and reported with their owner's ID;
+	// the others get their ID and timestamps set.
+	CreateOrders(ctx context.Context, orders []*Order, source string) (existing map[string]int, err error)
+	GetByNumber(ctx context.Context, number string) (*Order, error)
+	// ListByUser returns the user's orders, newest first.
+	ListByUser(ctx context.Context, userID int, q OrderQuery) ([]*Order, error)
+	// UpdateStatus moves the order from one status to another and records the
+	// event. Moving to PROCESSED with a positive accrual also credits it to
+	// the owner's balance, in the same transaction. It returns
+	// ErrOrderStatusChanged if the order is no longer in the from status.
+	UpdateStatus(ctx context.Context, number string, from, to OrderStatus, accrual *float64, source string) error
+	// CreditAccrual credits the accrual of a processed order unless it has
+	// already been credited, and reports whether it was.
+	CreditAccrual(ctx context.Context, order *Order) (bool, error)
+	ListEvents(ctx context.Context, orderID int) ([]*OrderEvent, error)
+	// CountByStatus returns the number of the user's orders per status.
+	CountByStatus(ctx context.Context, userID int) (map[OrderStatus]int, error)
+}
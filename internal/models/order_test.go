@@ -0,0 +1,37 @@
+package models
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestValidateTransition(t *testing.T) {
+	tests := []struct {
+		from  OrderStatus
+		to    OrderStatus
+		legal bool
+	}{
+		{from: OrderStatusNew, to: OrderStatusProcessing, legal: true},
+		{from: OrderStatusNew, to: OrderStatusInvalid, legal: true},
+		{from: OrderStatusNew, to: OrderStatusProcessed, legal: true},
+		{from: OrderStatusProcessing, to: OrderStatusInvalid, legal: true},
+		{from: OrderStatusProcessing, to: OrderStatusProcessed, legal: true},
+		{from: OrderStatusNew, to: OrderStatusNew, legal: false},
+		{from: OrderStatusProcessing, to: OrderStatusNew, legal: false},
+		{from: OrderStatusInvalid, to: OrderStatusProcessed, legal: false},
+		{from: OrderStatusProcessed, to: OrderStatusInvalid, legal: false},
+		{from: OrderStatusProcessed, to: OrderStatusProcessing, legal: false},
+		{from: OrderStatusProcessed, to: "UNKNOWN", legal: false},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.from)+"->"+string(test.to), func(t *testing.T) {
+			err := ValidateTransition(test.from, test.to)
+			if test.legal {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrIllegalTransition)
+			}
+		})
+	}
+}
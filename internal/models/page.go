@@ -0,0 +1,75 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// PageCursor points at the last item of a page of a listing sorted by time
+// and ID, newest first. The next page starts right after it.
+type PageCursor struct {
+	At time.Time
+	ID int
+}
+
+// Encode returns the opaque form of the cursor handed out to clients.
+func (c PageCursor) Encode() string {
+	raw := c.At.UTC().Format(time.RFC3339Nano) + "|" + strconv.Itoa(c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodePageCursor(s string) (*PageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	at, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+
+	var c PageCursor
+	if c.At, err = time.Parse(time.RFC3339Nano, at); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if c.ID, err = strconv.Atoi(id); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// PageQuery selects a page of a listing. The zero value selects everything.
+type PageQuery struct {
+	// Limit is the page size; 0 means no limit.
+	Limit int
+	After *PageCursor
+	// From and To bound the item time, From inclusive and To exclusive.
+	From *time.Time
+	To   *time.Time
+}
+
+// Includes reports whether an item with the given time and ID belongs to
+// the query, ignoring Limit.
+func (q PageQuery) Includes(at time.Time, id int) bool {
+	if q.From != nil && at.Before(*q.From) {
+		return false
+	}
+	if q.To != nil && !at.Before(*q.To) {
+		return false
+	}
+	if q.After != nil {
+		return at.Before(q.After.At) || (at.Equal(q.After.At) && id < q.After.ID)
+	}
+	return true
+}
+
+type OrderQuery struct {
+	PageQuery
+	// Statuses keeps only orders in one of the statuses; empty keeps all.
+	Statuses []OrderStatus
+}
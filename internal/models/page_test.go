@@ -0,0 +1,22 @@
+package models
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestPageCursor(t *testing.T) {
+	c := PageCursor{At: time.Date(2025, 3, 1, 12, 30, 0, 123456000, time.UTC), ID: 42}
+
+	decoded, err := DecodePageCursor(c.Encode())
+	require.NoError(t, err)
+	assert.True(t, c.At.Equal(decoded.At))
+	assert.Equal(t, c.ID, decoded.ID)
+
+	for _, s := range []string{"", "!!!", "bm8tc2VwYXJhdG9y", "eWVzdGVyZGF5fDE"} {
+		_, err := DecodePageCursor(s)
+		assert.ErrorIs(t, err, ErrInvalidCursor, s)
+	}
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrRecipientNotFound = errors.New("recipient not found")
+var ErrSelfTransfer = errors.New("cannot transfer points to yourself")
+var ErrTransferLimitExceeded = errors.New("daily transfer limit exceeded")
+
+// Transfer moves points from one user to another. It is posted to the
+// ledger as a TRANSFER_OUT entry of the sender and a TRANSFER_IN entry of
+// the recipient.
+type Transfer struct {
+	ID             int
+	SenderID       int
+	SenderLogin    string
+	RecipientID    int
+	RecipientLogin string
+	Amount         float64
+	CreatedAt      time.Time
+}
+
+type TransferRepository interface {
+	// Transfer resolves the recipient by login and moves the amount to them.
+	// It returns ErrRecipientNotFound, ErrSelfTransfer, ErrInsufficientFunds
+	// or, if the sender would send more than dailyMax during the last day,
+	// ErrTransferLimitExceeded. A zero dailyMax disables the limit.
+	Transfer(ctx context.Context, t *Transfer, dailyMax float64) error
+	// ListByUser returns the transfers sent or received by the user, newest
+	// first.
+	ListByUser(ctx context.Context, userID int, q PageQuery) ([]*Transfer, error)
+}
@@ -2,19 +2,41 @@ package models
 
 import (
 	"context"
+	"slices"
 	"time"
 )
 
+// Role grants access to route groups, see middlewares.RequireRole.
+type Role string
+
+const (
+	RoleUser Role = "user"
+	// RoleSupport may use the admin API.
+	RoleSupport Role = "support"
+	// RoleAdmin may also change the roles of users.
+	RoleAdmin Role = "admin"
+)
+
+func (r Role) Valid() bool {
+	return slices.Contains([]Role{RoleUser, RoleSupport, RoleAdmin}, r)
+}
+
 type User struct {
 	ID        int
 	Login     string
 	Password  string
+	Role      Role
 	CreatedAt time.Time
 }
 
 type UserRepository interface {
 	CreateUser(ctx context.Context, user *User) error
 	GetByLogin(ctx context.Context, login string) (*User, error)
+	// SetRole changes the role of the user and records audit.
+	SetRole(ctx context.Context, login string, role Role, audit *AuditEntry) error
+	// Anonymize deletes the account of the user, keeping the row under an
+	// anonymous login so that their ledger stays consistent.
+	Anonymize(ctx context.Context, userID int) error
 }
 
 type UserService interface {
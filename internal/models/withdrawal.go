@@ -0,0 +1,40 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrInsufficientFunds = errors.New("insufficient funds")
+var ErrWithdrawalExists = errors.New("withdrawal for this order already exists")
+var ErrWithdrawalNotFound = errors.New("withdrawal not found")
+var ErrWithdrawalRefunded = errors.New("withdrawal is already refunded")
+
+type Withdrawal struct {
+	ID          int
+	UserID      int
+	Order       string
+	Sum         float64
+	ProcessedAt time.Time
+	// RefundedAt is set once the withdrawal has been refunded.
+	RefundedAt   *time.Time
+	RefundReason string
+}
+
+func (w *Withdrawal) Refunded() bool {
+	return w.RefundedAt != nil
+}
+
+type WithdrawalRepository interface {
+	// Withdraw debits the sum from the user's balance and stores the
+	// withdrawal. It returns ErrInsufficientFunds if the balance is too low.
+	Withdraw(ctx context.Context, w *Withdrawal) error
+	// ListByUser returns the user's withdrawals, newest first.
+	ListByUser(ctx context.Context, userID int, q PageQuery) ([]*Withdrawal, error)
+	// Refund marks the withdrawal of the order as refunded and credits its
+	// sum back to the user, recording audit for them. It returns
+	// ErrWithdrawalNotFound or ErrWithdrawalRefunded if there is nothing to
+	// refund.
+	Refund(ctx context.Context, order, reason string, audit *AuditEntry) (*Withdrawal, error)
+}
@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rshafikov/gophermart/internal/database/queries"
+	"github.com/rshafikov/gophermart/internal/models"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+type AccrualJobRepository struct {
+	Pool *pgxpool.Pool
+}
+
+func NewAccrualJobRepository(pool *pgxpool.Pool) *AccrualJobRepository {
+	return &AccrualJobRepository{Pool: pool}
+}
+
+func (r *AccrualJobRepository) Enqueue(ctx context.Context, orderNumber string) error {
+	if _, err := r.Pool.Exec(ctx, queries.EnqueueAccrualJob, orderNumber); err != nil {
+		log.Println("unable to ENQUEUE accrual job:", err)
+		return err
+	}
+	return nil
+}
+
+func (r *AccrualJobRepository) Lease(ctx context.Context, limit int, visibility time.Duration) ([]*models.AccrualJob, error) {
+	rows, err := r.Pool.Query(ctx, queries.LeaseAccrualJobs, limit, visibility.Seconds())
+	if err != nil {
+		log.Println("unable to LEASE accrual jobs:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*models.AccrualJob
+	for rows.Next() {
+		job, err := scanAccrualJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+func (r *AccrualJobRepository) Complete(ctx context.Context, job *models.AccrualJob) error {
+	return r.update(ctx, queries.CompleteAccrualJob, job)
+}
+
+func (r *AccrualJobRepository) Reschedule(ctx context.Context, job *models.AccrualJob, runAt time.Time) error {
+	return r.update(ctx, queries.RescheduleAccrualJob, job, runAt)
+}
+
+func (r *AccrualJobRepository) Release(ctx context.Context, job *models.AccrualJob, runAt time.Time) error {
+	return r.update(ctx, queries.ReleaseAccrualJob, job, runAt)
+}
+
+func (r *AccrualJobRepository) Retry(ctx context.Context, job *models.AccrualJob, runAt time.Time, reason string) error {
+	return r.update(ctx, queries.RetryAccrualJob, job, runAt, reason)
+}
+
+func (r *AccrualJobRepository) Bury(ctx context.Context, job *models.AccrualJob, reason string) error {
+	return r.update(ctx, queries.BuryAccrualJob, job, reason)
+}
+
+func (r *AccrualJobRepository) update(ctx context.Context, query string, job *models.AccrualJob, args ...any) error {
+	tag, err := r.Pool.Exec(ctx, query, append([]any{job.OrderNumber, job.LockedUntil}, args...)...)
+	if err != nil {
+		log.Println("unable to UPDATE accrual job:", err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return models.ErrLeaseLost
+	}
+	return nil
+}
+
+func scanAccrualJob(row pgx.Row) (*models.AccrualJob, error) {
+	var j models.AccrualJob
+	err := row.Scan(&j.OrderNumber, &j.Status, &j.Attempts, &j.NextRunAt, &j.LockedUntil, &j.LastError)
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// MockAccrualJobQueue is an in-memory AccrualJobQueue. Now may be replaced to
+// control the clock.
+type MockAccrualJobQueue struct {
+	mu   sync.Mutex
+	Jobs map[string]*models.AccrualJob
+	Now  func() time.Time
+}
+
+func NewMockAccrualJobQueue() *MockAccrualJobQueue {
+	return &MockAccrualJobQueue{Jobs: make(map[string]*models.AccrualJob), Now: time.Now}
+}
+
+func (m *MockAccrualJobQueue) Enqueue(ctx context.Context, orderNumber string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Jobs[orderNumber] = &models.AccrualJob{
+		OrderNumber: orderNumber,
+		Status:      models.AccrualJobPending,
+		NextRunAt:   m.Now(),
+	}
+	return nil
+}
+
+func (m *MockAccrualJobQueue) Lease(ctx context.Context, limit int, visibility time.Duration) ([]*models.AccrualJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.Now()
+	var due []*models.AccrualJob
+	for _, job := range m.Jobs {
+		if job.Status != models.AccrualJobPending || job.NextRunAt.After(now) {
+			continue
+		}
+		if job.LockedUntil != nil && job.LockedUntil.After(now) {
+			continue
+		}
+		due = append(due, job)
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextRunAt.Before(due[j].NextRunAt) })
+	if limit > 0 && len(due) > limit {
+		due = due[:limit]
+	}
+
+	leased := make([]*models.AccrualJob, 0, len(due))
+	lockedUntil := now.Add(visibility)
+	for _, job := range due {
+		job.Attempts++
+		job.LockedUntil = &lockedUntil
+		cp := *job
+		leased = append(leased, &cp)
+	}
+	return leased, nil
+}
+
+func (m *MockAccrualJobQueue) Complete(ctx context.Context, job *models.AccrualJob) error {
+	return m.update(job, func(j *models.AccrualJob) {
+		j.Status = models.AccrualJobDone
+		j.LastError = nil
+	})
+}
+
+func (m *MockAccrualJobQueue) Reschedule(ctx context.Context, job *models.AccrualJob, runAt time.Time) error {
+	return m.update(job, func(j *models.AccrualJob) {
+		j.Attempts = 0
+		j.NextRunAt = runAt
+		j.LastError = nil
+	})
+}
+
+func (m *MockAccrualJobQueue) Release(ctx context.Context, job *models.AccrualJob, runAt time.Time) error {
+	return m.update(job, func(j *models.AccrualJob) {
+		j.Attempts = max(j.Attempts-1, 0)
+		j.NextRunAt = runAt
+	})
+}
+
+func (m *MockAccrualJobQueue) Retry(ctx context.Context, job *models.AccrualJob, runAt time.Time, reason string) error {
+	return m.update(job, func(j *models.AccrualJob) {
+		j.NextRunAt = runAt
+		j.LastError = &reason
+	})
+}
+
+func (m *MockAccrualJobQueue) Bury(ctx context.Context, job *models.AccrualJob, reason string) error {
+	return m.update(job, func(j *models.AccrualJob) {
+		j.Status = models.AccrualJobDead
+		j.LastError = &reason
+	})
+}
+
+// Get returns a copy of the job for assertions.
+func (m *MockAccrualJobQueue) Get(orderNumber string) (models.AccrualJob, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.Jobs[orderNumber]
+	if !ok {
+		return models.AccrualJob{}, false
+	}
+	return *job, true
+}
+
+func (m *MockAccrualJobQueue) update(job *models.AccrualJob, apply func(*models.AccrualJob)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.Jobs[job.OrderNumber]
+	if !ok || stored.LockedUntil == nil || job.LockedUntil == nil || !stored.LockedUntil.Equal(*job.LockedUntil) {
+		return models.ErrLeaseLost
+	}
+	apply(stored)
+	stored.LockedUntil = nil
+	return nil
+}
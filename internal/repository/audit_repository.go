@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rshafikov/gophermart/internal/database/queries"
+	"github.com/rshafikov/gophermart/internal/models"
+	"log"
+	"sync"
+	"time"
+)
+
+type AuditRepository struct {
+	Pool *pgxpool.Pool
+}
+
+func NewAuditRepository(pool *pgxpool.Pool) *AuditRepository {
+	return &AuditRepository{Pool: pool}
+}
+
+// recordAudit appends the entry to the log within tx.
+func recordAudit(ctx context.Context, tx pgx.Tx, e *models.AuditEntry) error {
+	return tx.QueryRow(ctx, queries.CreateAuditEntry, e.ActorID, e.UserID, e.Action, e.Reason, e.Details).
+		Scan(&e.ID, &e.CreatedAt)
+}
+
+func (r *AuditRepository) List(ctx context.Context, q models.AuditQuery) ([]*models.AuditEntry, error) {
+	rows, err := r.Pool.Query(ctx, queries.ListAuditLog, append([]any{q.ActorID, q.UserID}, pageArgs(q.PageQuery)...)...)
+	if err != nil {
+		log.Println("unable to LIST audit log:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*models.AuditEntry
+	for rows.Next() {
+		var e models.AuditEntry
+		err := rows.Scan(&e.ID, &e.ActorID, &e.Actor, &e.UserID, &e.User, &e.Action, &e.Reason, &e.Details, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &e)
+	}
+	return entries, rows.Err()
+}
+
+// MockAuditRepository keeps the entries recorded by the mock repositories
+// sharing it. List does not fill Actor and User.
+type MockAuditRepository struct {
+	mu      sync.Mutex
+	Entries []*models.AuditEntry
+}
+
+func NewMockAuditRepository() *MockAuditRepository {
+	return &MockAuditRepository{}
+}
+
+func (m *MockAuditRepository) record(e *models.AuditEntry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e.ID = len(m.Entries) + 1
+	e.CreatedAt = time.Now()
+	cp := *e
+	m.Entries = append(m.Entries, &cp)
+}
+
+func (m *MockAuditRepository) List(ctx context.Context, q models.AuditQuery) ([]*models.AuditEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var entries []*models.AuditEntry
+	for _, e := range m.Entries {
+		if q.ActorID != nil && e.ActorID != *q.ActorID || q.UserID != nil && e.UserID != *q.UserID {
+			continue
+		}
+		if q.Includes(e.CreatedAt, e.ID) {
+			cp := *e
+			entries = append(entries, &cp)
+		}
+	}
+	entries = sortPage(entries, func(e *models.AuditEntry) (time.Time, int) { return e.CreatedAt, e.ID }, q.Limit)
+	return entries, nil
+}
@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rshafikov/gophermart/internal/database/queries"
+	"github.com/rshafikov/gophermart/internal/models"
+	"log"
+	"sync"
+	"time"
+)
+
+type IdempotencyRepository struct {
+	Pool *pgxpool.Pool
+}
+
+func NewIdempotencyRepository(pool *pgxpool.Pool) *IdempotencyRepository {
+	return &IdempotencyRepository{Pool: pool}
+}
+
+func (r *IdempotencyRepository) Reserve(ctx context.Context, rec *models.IdempotencyRecord, lease time.Duration) (*models.IdempotencyRecord, error) {
+	err := r.Pool.QueryRow(ctx, queries.ReserveIdempotencyKey, rec.UserID, rec.Key, rec.RequestHash, rec.ExpiresAt, lease.Seconds()).Scan(&rec.LockedUntil)
+	if err == nil {
+		return nil, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		log.Println("unable to RESERVE idempotency key:", err)
+		return nil, err
+	}
+
+	var existing models.IdempotencyRecord
+	err = r.Pool.QueryRow(ctx, queries.GetIdempotencyKey, rec.UserID, rec.Key).Scan(
+		&existing.UserID, &existing.Key, &existing.RequestHash, &existing.StatusCode,
+		&existing.ContentType, &existing.Body, &existing.ExpiresAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, models.ErrIdempotencyKeyGone
+	}
+	if err != nil {
+		log.Println("unable to GET idempotency key:", err)
+		return nil, err
+	}
+	return &existing, nil
+}
+
+func (r *IdempotencyRepository) Complete(ctx context.Context, rec *models.IdempotencyRecord) error {
+	tag, err := r.Pool.Exec(ctx, queries.CompleteIdempotencyKey, rec.UserID, rec.Key, rec.LockedUntil, rec.StatusCode, rec.ContentType, rec.Body)
+	if err != nil {
+		log.Println("unable to COMPLETE idempotency key:", err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return models.ErrIdempotencyLeaseLost
+	}
+	return nil
+}
+
+func (r *IdempotencyRepository) Release(ctx context.Context, rec *models.IdempotencyRecord) error {
+	tag, err := r.Pool.Exec(ctx, queries.DeleteIdempotencyKey, rec.UserID, rec.Key, rec.LockedUntil)
+	if err != nil {
+		log.Println("unable to DELETE idempotency key:", err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return models.ErrIdempotencyLeaseLost
+	}
+	return nil
+}
+
+func (r *IdempotencyRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	tag, err := r.Pool.Exec(ctx, queries.DeleteExpiredIdempotencyKeys)
+	if err != nil {
+		log.Println("unable to DELETE expired idempotency keys:", err)
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+type idempotencyKey struct {
+	userID int
+	key    string
+}
+
+type MockIdempotencyRepository struct {
+	mu      sync.Mutex
+	Records map[idempotencyKey]*models.IdempotencyRecord
+	Now     func() time.Time
+	// CompleteErrs fails that many Complete calls.
+	CompleteErrs int
+}
+
+func NewMockIdempotencyRepository() *MockIdempotencyRepository {
+	return &MockIdempotencyRepository{Records: make(map[idempotencyKey]*models.IdempotencyRecord), Now: time.Now}
+}
+
+func (m *MockIdempotencyRepository) Reserve(ctx context.Context, rec *models.IdempotencyRecord, lease time.Duration) (*models.IdempotencyRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.Now()
+	k := idempotencyKey{rec.UserID, rec.Key}
+	if existing, ok := m.Records[k]; ok && existing.ExpiresAt.After(now) &&
+		(existing.StatusCode != 0 || existing.LockedUntil.After(now)) {
+		cp := *existing
+		return &cp, nil
+	}
+	lockedUntil := now.Add(lease)
+	rec.LockedUntil = &lockedUntil
+	cp := *rec
+	cp.StatusCode = 0
+	m.Records[k] = &cp
+	return nil, nil
+}
+
+func (m *MockIdempotencyRepository) Complete(ctx context.Context, rec *models.IdempotencyRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.CompleteErrs > 0 {
+		m.CompleteErrs--
+		return errors.New("complete failed")
+	}
+	stored, ok := m.Records[idempotencyKey{rec.UserID, rec.Key}]
+	if !ok || !m.holds(stored, rec) {
+		return models.ErrIdempotencyLeaseLost
+	}
+	stored.StatusCode = rec.StatusCode
+	stored.ContentType = rec.ContentType
+	stored.Body = rec.Body
+	stored.LockedUntil = nil
+	return nil
+}
+
+func (m *MockIdempotencyRepository) Release(ctx context.Context, rec *models.IdempotencyRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k := idempotencyKey{rec.UserID, rec.Key}
+	stored, ok := m.Records[k]
+	if !ok || !m.holds(stored, rec) {
+		return models.ErrIdempotencyLeaseLost
+	}
+	delete(m.Records, k)
+	return nil
+}
+
+func (m *MockIdempotencyRepository) holds(stored, rec *models.IdempotencyRecord) bool {
+	return stored.LockedUntil != nil && rec.LockedUntil != nil && stored.LockedUntil.Equal(*rec.LockedUntil)
+}
+
+func (m *MockIdempotencyRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var n int64
+	for k, rec := range m.Records {
+		if !rec.ExpiresAt.After(m.Now()) {
+			delete(m.Records, k)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,385 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rshafikov/gophermart/internal/database/queries"
+	"github.com/rshafikov/gophermart/internal/models"
+	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+type LedgerRepository struct {
+	Pool *pgxpool.Pool
+	// Expiry is written off before debits, see expireDue.
+	Expiry models.ExpiryPolicy
+}
+
+func NewLedgerRepository(pool *pgxpool.Pool) *LedgerRepository {
+	return &LedgerRepository{Pool: pool}
+}
+
+func (r *LedgerRepository) GetBalance(ctx context.Context, userID int) (*models.Balance, error) {
+	var b models.Balance
+	err := r.Pool.QueryRow(ctx, queries.GetBalance, userID).Scan(&b.Current, &b.Withdrawn)
+	if err != nil {
+		log.Println("unable to GET balance:", err)
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (r *LedgerRepository) Adjust(ctx context.Context, e *models.LedgerEntry, audit *models.AuditEntry) error {
+	err := pgx.BeginFunc(ctx, r.Pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, queries.LockUser, e.UserID); err != nil {
+			return err
+		}
+
+		if e.Amount < 0 {
+			if err := expireDue(ctx, tx, r.Expiry, e.UserID); err != nil {
+				return err
+			}
+			var ok bool
+			if err := tx.QueryRow(ctx, queries.HasFunds, e.UserID, -e.Amount).Scan(&ok); err != nil {
+				return err
+			}
+			if !ok {
+				return models.ErrInsufficientFunds
+			}
+		}
+
+		e.Kind = models.LedgerAdjustment
+		if err := tx.QueryRow(ctx, queries.CreateAdjustment, e.UserID, e.Amount, e.Reason).Scan(&e.ID, &e.CreatedAt); err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, audit)
+	})
+	if err != nil && !errors.Is(err, models.ErrInsufficientFunds) {
+		log.Println("unable to CREATE adjustment:", err)
+	}
+	return err
+}
+
+func (r *LedgerRepository) ListTransactions(ctx context.Context, userID int, q models.TransactionQuery) ([]*models.Transaction, error) {
+	var kinds []string
+	for _, k := range q.Kinds {
+		kinds = append(kinds, string(k))
+	}
+	rows, err := r.Pool.Query(ctx, queries.ListTransactions, append([]any{userID, kinds}, pageArgs(q.PageQuery)...)...)
+	if err != nil {
+		log.Println("unable to LIST transactions:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transactions []*models.Transaction
+	for rows.Next() {
+		var t models.Transaction
+		err := rows.Scan(&t.ID, &t.UserID, &t.Kind, &t.Amount, &t.OrderNumber, &t.TransferID, &t.Reason, &t.CreatedAt, &t.Balance, &t.Counterpart)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, &t)
+	}
+	return transactions, rows.Err()
+}
+
+func (r *LedgerRepository) ListEntries(ctx context.Context, userID int) ([]*models.LedgerEntry, error) {
+	entries, err := listLedgerEntries(ctx, r.Pool, userID)
+	if err != nil {
+		log.Println("unable to LIST ledger entries:", err)
+	}
+	return entries, err
+}
+
+func (r *LedgerRepository) ListUsersWithExpiredCredits(ctx context.Context, policy models.ExpiryPolicy, now time.Time) ([]int, error) {
+	rows, err := r.Pool.Query(ctx, queries.ListUsersWithExpiredCredits, policy.CreditedBefore(now), policy.Months)
+	if err != nil {
+		log.Println("unable to LIST users with credits:", err)
+		return nil, err
+	}
+	userIDs, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		log.Println("unable to LIST users with credits:", err)
+	}
+	return userIDs, err
+}
+
+func (r *LedgerRepository) Expire(ctx context.Context, userID int, at time.Time, due func([]*models.LedgerEntry) float64) (float64, error) {
+	var amount float64
+	err := pgx.BeginFunc(ctx, r.Pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, queries.LockUser, userID); err != nil {
+			return err
+		}
+
+		entries, err := listLedgerEntries(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+		if amount = due(entries); amount <= 0 {
+			return nil
+		}
+
+		_, err = tx.Exec(ctx, queries.CreateExpiration, userID, amount, at)
+		return err
+	})
+	if err != nil {
+		log.Println("unable to CREATE expiration:", err)
+		return 0, err
+	}
+	return amount, nil
+}
+
+// expireDue writes off the points of the locked user that have expired but
+// not been written off yet, so that a debit made in tx cannot spend them.
+func expireDue(ctx context.Context, tx pgx.Tx, policy models.ExpiryPolicy, userID int) error {
+	if !policy.Enabled() {
+		return nil
+	}
+	entries, err := listLedgerEntries(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if amount := policy.Due(entries, now); amount > 0 {
+		_, err = tx.Exec(ctx, queries.CreateExpiration, userID, amount, now)
+	}
+	return err
+}
+
+// querier is implemented by both *pgxpool.Pool and pgx.Tx.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+func listLedgerEntries(ctx context.Context, q querier, userID int) ([]*models.LedgerEntry, error) {
+	rows, err := q.Query(ctx, queries.ListLedgerEntries, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*models.LedgerEntry
+	for rows.Next() {
+		var e models.LedgerEntry
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Kind, &e.Amount, &e.OrderNumber, &e.TransferID, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, &e)
+	}
+	return entries, rows.Err()
+}
+
+// MockLedgerRepository keeps entries in memory and enforces the one accrual
+// credit per order constraint of the database. Adjustments, and refunds of
+// the withdrawal mock, are recorded to Audit. Debits write off the points
+// expired under Expiry first.
+type MockLedgerRepository struct {
+	mu      sync.Mutex
+	Entries []*models.LedgerEntry
+	Audit   *MockAuditRepository
+	Expiry  models.ExpiryPolicy
+}
+
+func NewMockLedgerRepository() *MockLedgerRepository {
+	return &MockLedgerRepository{Audit: NewMockAuditRepository()}
+}
+
+func (m *MockLedgerRepository) GetBalance(ctx context.Context, userID int) (*models.Balance, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b models.Balance
+	for _, e := range m.Entries {
+		if e.UserID != userID {
+			continue
+		}
+		b.Current += e.Amount
+		if e.Kind == models.LedgerWithdrawal || e.Kind == models.LedgerRefund {
+			b.Withdrawn -= e.Amount
+		}
+	}
+	return &b, nil
+}
+
+func (m *MockLedgerRepository) Adjust(ctx context.Context, e *models.LedgerEntry, audit *models.AuditEntry) error {
+	e.Kind = models.LedgerAdjustment
+	e.CreatedAt = time.Now()
+	if e.Amount > 0 {
+		m.credit(*e)
+	} else if err := m.debit(*e); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	e.ID = len(m.Entries)
+	m.mu.Unlock()
+
+	m.Audit.record(audit)
+	return nil
+}
+
+// ListTransactions does not fill the counterparts of transfers.
+func (m *MockLedgerRepository) ListTransactions(ctx context.Context, userID int, q models.TransactionQuery) ([]*models.Transaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var balance float64
+	var transactions []*models.Transaction
+	for _, e := range m.userEntries(userID) {
+		balance = models.RoundPoints(balance + e.Amount)
+		if len(q.Kinds) > 0 && !slices.Contains(q.Kinds, e.Kind) {
+			continue
+		}
+		if q.Includes(e.CreatedAt, e.ID) {
+			transactions = append(transactions, &models.Transaction{LedgerEntry: *e, Balance: balance})
+		}
+	}
+	transactions = sortPage(transactions, func(t *models.Transaction) (time.Time, int) { return t.CreatedAt, t.ID }, q.Limit)
+	return transactions, nil
+}
+
+func (m *MockLedgerRepository) ListEntries(ctx context.Context, userID int) ([]*models.LedgerEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.userEntries(userID), nil
+}
+
+func (m *MockLedgerRepository) ListUsersWithExpiredCredits(ctx context.Context, policy models.ExpiryPolicy, now time.Time) ([]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	balances := make(map[int]float64)
+	expiredAt := make(map[int]time.Time)
+	for _, e := range m.Entries {
+		balances[e.UserID] += e.Amount
+		if e.Kind == models.LedgerExpiration && e.CreatedAt.After(expiredAt[e.UserID]) {
+			expiredAt[e.UserID] = e.CreatedAt
+		}
+	}
+	before := policy.CreditedBefore(now)
+	credited := make(map[int]bool)
+	for _, e := range m.Entries {
+		if e.Amount > 0 && e.CreatedAt.Before(before) && policy.ExpiresAt(e.CreatedAt).After(expiredAt[e.UserID]) {
+			credited[e.UserID] = true
+		}
+	}
+
+	var userIDs []int
+	for userID := range credited {
+		if balances[userID] > 0 {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	slices.Sort(userIDs)
+	return userIDs, nil
+}
+
+func (m *MockLedgerRepository) Expire(ctx context.Context, userID int, at time.Time, due func([]*models.LedgerEntry) float64) (float64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	amount := due(m.userEntries(userID))
+	if amount > 0 {
+		m.Entries = append(m.Entries, &models.LedgerEntry{
+			ID:        len(m.Entries) + 1,
+			UserID:    userID,
+			Kind:      models.LedgerExpiration,
+			Amount:    -amount,
+			CreatedAt: at,
+		})
+	}
+	return max(amount, 0), nil
+}
+
+// userEntries returns copies of the user's entries, oldest first.
+func (m *MockLedgerRepository) userEntries(userID int) []*models.LedgerEntry {
+	var entries []*models.LedgerEntry
+	for _, e := range m.Entries {
+		if e.UserID == userID {
+			cp := *e
+			entries = append(entries, &cp)
+		}
+	}
+	slices.SortStableFunc(entries, func(a, b *models.LedgerEntry) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return entries
+}
+
+// Credits returns the accrual entries of the order.
+func (m *MockLedgerRepository) Credits(orderNumber string) []models.LedgerEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var credits []models.LedgerEntry
+	for _, e := range m.Entries {
+		if e.Kind == models.LedgerAccrual && e.OrderNumber != nil && *e.OrderNumber == orderNumber {
+			credits = append(credits, *e)
+		}
+	}
+	return credits
+}
+
+func (m *MockLedgerRepository) creditAccrual(userID int, amount float64, orderNumber string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, e := range m.Entries {
+		if e.Kind == models.LedgerAccrual && e.OrderNumber != nil && *e.OrderNumber == orderNumber {
+			return false
+		}
+	}
+	m.Entries = append(m.Entries, &models.LedgerEntry{
+		ID:          len(m.Entries) + 1,
+		UserID:      userID,
+		Kind:        models.LedgerAccrual,
+		Amount:      amount,
+		OrderNumber: &orderNumber,
+		CreatedAt:   time.Now(),
+	})
+	return true
+}
+
+// credit appends the entry, whose amount is positive.
+func (m *MockLedgerRepository) credit(e models.LedgerEntry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e.ID = len(m.Entries) + 1
+	m.Entries = append(m.Entries, &e)
+}
+
+// debit appends the entry, whose amount is negative, if the user's balance
+// without the expired points covers it. The expired points are then written
+// off first.
+func (m *MockLedgerRepository) debit(e models.LedgerEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries := m.userEntries(e.UserID)
+	var balance float64
+	for _, prev := range entries {
+		balance += prev.Amount
+	}
+	expired := m.Expiry.Due(entries, e.CreatedAt)
+	if balance-expired < -e.Amount {
+		return models.ErrInsufficientFunds
+	}
+
+	if expired > 0 {
+		m.Entries = append(m.Entries, &models.LedgerEntry{
+			ID:        len(m.Entries) + 1,
+			UserID:    e.UserID,
+			Kind:      models.LedgerExpiration,
+			Amount:    -expired,
+			CreatedAt: e.CreatedAt,
+		})
+	}
+	e.ID = len(m.Entries) + 1
+	m.Entries = append(m.Entries, &e)
+	return nil
+}
@@ -0,0 +1,385 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rshafikov/gophermart/internal/database/queries"
+	"github.com/rshafikov/gophermart/internal/models"
+	"log"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+const pgUniqueViolation = "23505"
+
+type OrderRepository struct {
+	Pool *pgxpool.Pool
+}
+
+func NewOrderRepository(pool *pgxpool.Pool) *OrderRepository {
+	return &OrderRepository{Pool: pool}
+}
+
+func (r *OrderRepository) CreateOrder(ctx context.Context, order *models.Order, source string) error {
+	row := r.Pool.QueryRow(ctx, queries.CreateOrder, order.Number, order.UserID, order.Status, source)
+	err := row.Scan(&order.ID, &order.UploadedAt, &order.UpdatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+			return models.ErrOrderExists
+		}
+		log.Println("unable to CREATE order:", err)
+		return err
+	}
+	return nil
+}
+
+func (r *OrderRepository) CreateOrders(ctx context.Context, orders []*models.Order, source string) (map[string]int, error) {
+	existing := make(map[string]int)
+	err := pgx.BeginFunc(ctx, r.Pool, func(tx pgx.Tx) error {
+		batch := &pgx.Batch{}
+		for _, order := range orders {
+			batch.Queue(queries.CreateOrderIfAbsent, order.Number, order.UserID, order.Status, source).
+				QueryRow(func(row pgx.Row) error {
+					err := row.Scan(&order.ID, &order.UploadedAt, &order.UpdatedAt)
+					if errors.Is(err, pgx.ErrNoRows) {
+						existing[order.Number] = 0
+						return nil
+					}
+					return err
+				})
+		}
+		if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+			return err
+		}
+		if len(existing) == 0 {
+			return nil
+		}
+
+		numbers := make([]string, 0, len(existing))
+		for number := range existing {
+			numbers = append(numbers, number)
+		}
+		rows, err := tx.Query(ctx, queries.GetOrderOwners, numbers)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var number string
+			var owner int
+			if err := rows.Scan(&number, &owner); err != nil {
+				return err
+			}
+			existing[number] = owner
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		log.Println("unable to CREATE orders:", err)
+		return nil, err
+	}
+	return existing, nil
+}
+
+func (r *OrderRepository) GetByNumber(ctx context.Context, number string) (*models.Order, error) {
+	order, err := scanOrder(r.Pool.QueryRow(ctx, queries.GetOrderByNumber, number))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, models.ErrOrderNotFound
+		}
+		log.Println("unable to GET order, unknown error:", err)
+		return nil, err
+	}
+	return order, nil
+}
+
+func (r *OrderRepository) ListByUser(ctx context.Context, userID int, q models.OrderQuery) ([]*models.Order, error) {
+	var statuses []string
+	for _, s := range q.Statuses {
+		statuses = append(statuses, string(s))
+	}
+	args := append([]any{userID, statuses}, pageArgs(q.PageQuery)...)
+	return r.list(ctx, queries.ListOrdersByUser, args...)
+}
+
+func (r *OrderRepository) UpdateStatus(ctx context.Context, number string, from, to models.OrderStatus, accrual *float64, source string) error {
+	err := pgx.BeginFunc(ctx, r.Pool, func(tx pgx.Tx) error {
+		var userID int
+		err := tx.QueryRow(ctx, queries.UpdateOrderStatus, number, from, to, accrual, source).Scan(&userID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.ErrOrderStatusChanged
+		}
+		if err != nil {
+			return err
+		}
+
+		if creditable(to, accrual) {
+			_, err = tx.Exec(ctx, queries.CreditOrderAccrual, userID, *accrual, number)
+		}
+		return err
+	})
+	if err != nil && !errors.Is(err, models.ErrOrderStatusChanged) {
+		log.Println("unable to UPDATE order:", err)
+	}
+	return err
+}
+
+func (r *OrderRepository) CreditAccrual(ctx context.Context, order *models.Order) (bool, error) {
+	if !creditable(order.Status, order.Accrual) {
+		return false, nil
+	}
+	tag, err := r.Pool.Exec(ctx, queries.CreditOrderAccrual, order.UserID, *order.Accrual, order.Number)
+	if err != nil {
+		log.Println("unable to CREDIT order accrual:", err)
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *OrderRepository) ListEvents(ctx context.Context, orderID int) ([]*models.OrderEvent, error) {
+	rows, err := r.Pool.Query(ctx, queries.ListOrderEvents, orderID)
+	if err != nil {
+		log.Println("unable to LIST order events:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*models.OrderEvent
+	for rows.Next() {
+		var e models.OrderEvent
+		err := rows.Scan(&e.ID, &e.OrderID, &e.From, &e.To, &e.Accrual, &e.Source, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, &e)
+	}
+	return events, rows.Err()
+}
+
+func (r *OrderRepository) CountByStatus(ctx context.Context, userID int) (map[models.OrderStatus]int, error) {
+	rows, err := r.Pool.Query(ctx, queries.CountOrdersByStatus, userID)
+	if err != nil {
+		log.Println("unable to COUNT orders:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[models.OrderStatus]int)
+	for rows.Next() {
+		var status models.OrderStatus
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, err
+		}
+		counts[status] = n
+	}
+	return counts, rows.Err()
+}
+
+func (r *OrderRepository) list(ctx context.Context, query string, args ...any) ([]*models.Order, error) {
+	rows, err := r.Pool.Query(ctx, query, args...)
+	if err != nil {
+		log.Println("unable to LIST orders:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []*models.Order
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+	return orders, rows.Err()
+}
+
+func creditable(status models.OrderStatus, accrual *float64) bool {
+	return status == models.OrderStatusProcessed && accrual != nil && *accrual > 0
+}
+
+func scanOrder(row pgx.Row) (*models.Order, error) {
+	var o models.Order
+	err := row.Scan(&o.ID, &o.Number, &o.UserID, &o.Status, &o.Accrual, &o.UploadedAt, &o.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// MockOrderRepository schedules accrual checks of created orders in Jobs
+// and credits accruals to Ledger, like the database implementation does.
+type MockOrderRepository struct {
+	mu     sync.Mutex
+	DB     map[string]*models.Order
+	Events []*models.OrderEvent
+	Jobs   *MockAccrualJobQueue
+	Ledger *MockLedgerRepository
+	// CreditErr, when set, fails the next credit after the order update,
+	// which is then rolled back as if the process crashed mid-transaction.
+	CreditErr error
+	nextID    int
+}
+
+func NewMockOrderRepository() *MockOrderRepository {
+	return &MockOrderRepository{
+		DB:     make(map[string]*models.Order),
+		Jobs:   NewMockAccrualJobQueue(),
+		Ledger: NewMockLedgerRepository(),
+	}
+}
+
+func (m *MockOrderRepository) CreateOrder(ctx context.Context, order *models.Order, source string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.DB[order.Number]; ok {
+		return models.ErrOrderExists
+	}
+	m.nextID++
+	order.ID = m.nextID
+	order.UploadedAt = time.Now().Add(time.Duration(m.nextID) * time.Millisecond)
+	order.UpdatedAt = order.UploadedAt
+	cp := *order
+	m.DB[order.Number] = &cp
+	m.addEvent(order, nil, source)
+	return m.Jobs.Enqueue(ctx, order.Number)
+}
+
+func (m *MockOrderRepository) CreateOrders(ctx context.Context, orders []*models.Order, source string) (map[string]int, error) {
+	existing := make(map[string]int)
+	for _, order := range orders {
+		err := m.CreateOrder(ctx, order, source)
+		if errors.Is(err, models.ErrOrderExists) {
+			stored, err := m.GetByNumber(ctx, order.Number)
+			if err != nil {
+				return nil, err
+			}
+			existing[order.Number] = stored.UserID
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return existing, nil
+}
+
+func (m *MockOrderRepository) GetByNumber(ctx context.Context, number string) (*models.Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	order, ok := m.DB[number]
+	if !ok {
+		return nil, models.ErrOrderNotFound
+	}
+	cp := *order
+	return &cp, nil
+}
+
+func (m *MockOrderRepository) ListByUser(ctx context.Context, userID int, q models.OrderQuery) ([]*models.Order, error) {
+	return m.filter(func(o *models.Order) bool {
+		if len(q.Statuses) > 0 && !slices.Contains(q.Statuses, o.Status) {
+			return false
+		}
+		return o.UserID == userID && q.Includes(o.UploadedAt, o.ID)
+	}, func(a, b *models.Order) bool {
+		return newerFirst(a.UploadedAt, a.ID, b.UploadedAt, b.ID)
+	}, q.Limit), nil
+}
+
+func (m *MockOrderRepository) UpdateStatus(ctx context.Context, number string, from, to models.OrderStatus, accrual *float64, source string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	order, ok := m.DB[number]
+	if !ok || order.Status != from {
+		return models.ErrOrderStatusChanged
+	}
+	if creditable(to, accrual) && m.CreditErr != nil {
+		err := m.CreditErr
+		m.CreditErr = nil
+		return err
+	}
+
+	order.Status = to
+	order.Accrual = accrual
+	order.UpdatedAt = time.Now()
+	m.addEvent(order, &from, source)
+	if creditable(to, accrual) {
+		m.Ledger.creditAccrual(order.UserID, *accrual, number)
+	}
+	return nil
+}
+
+func (m *MockOrderRepository) CreditAccrual(ctx context.Context, order *models.Order) (bool, error) {
+	if !creditable(order.Status, order.Accrual) {
+		return false, nil
+	}
+	return m.Ledger.creditAccrual(order.UserID, *order.Accrual, order.Number), nil
+}
+
+func (m *MockOrderRepository) ListEvents(ctx context.Context, orderID int) ([]*models.OrderEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var events []*models.OrderEvent
+	for _, e := range m.Events {
+		if e.OrderID == orderID {
+			cp := *e
+			events = append(events, &cp)
+		}
+	}
+	return events, nil
+}
+
+// addEvent must be called with m.mu held.
+func (m *MockOrderRepository) CountByStatus(ctx context.Context, userID int) (map[models.OrderStatus]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counts := make(map[models.OrderStatus]int)
+	for _, o := range m.DB {
+		if o.UserID == userID {
+			counts[o.Status]++
+		}
+	}
+	return counts, nil
+}
+
+func (m *MockOrderRepository) addEvent(order *models.Order, from *models.OrderStatus, source string) {
+	m.Events = append(m.Events, &models.OrderEvent{
+		ID:        len(m.Events) + 1,
+		OrderID:   order.ID,
+		From:      from,
+		To:        order.Status,
+		Accrual:   order.Accrual,
+		Source:    source,
+		CreatedAt: order.UpdatedAt,
+	})
+}
+
+func (m *MockOrderRepository) filter(keep func(*models.Order) bool, less func(a, b *models.Order) bool, limit int) []*models.Order {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var orders []*models.Order
+	for _, o := range m.DB {
+		if keep(o) {
+			cp := *o
+			orders = append(orders, &cp)
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool { return less(orders[i], orders[j]) })
+	if limit > 0 && len(orders) > limit {
+		orders = orders[:limit]
+	}
+	return orders
+}
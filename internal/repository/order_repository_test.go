@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rshafikov/gophermart/internal/database/queries"
+	"github.com/rshafikov/gophermart/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testPool connects to TEST_DATABASE_URI and applies the migrations. Tests
+// using it are skipped when the variable is not set.
+func testPool(t *testing.T) *pgxpool.Pool {
+	uri := os.Getenv("TEST_DATABASE_URI")
+	if uri == "" {
+		t.Skip("TEST_DATABASE_URI is not set")
+	}
+
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, uri)
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+
+	files, err := filepath.Glob("../../migrations/*_*.sql")
+	require.NoError(t, err)
+	sort.Strings(files)
+	for _, file := range files {
+		sql, err := os.ReadFile(file)
+		require.NoError(t, err)
+		_, err = pool.Exec(ctx, string(sql))
+		require.NoError(t, err, file)
+	}
+
+	return pool
+}
+
+func TestOrderRepository_CreditsOnce(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+
+	users := NewUserRepository(pool)
+	login := fmt.Sprintf("credit_%d", time.Now().UnixNano())
+	require.NoError(t, users.CreateUser(ctx, &models.User{Login: login, Password: "x"}))
+	user, err := users.GetByLogin(ctx, login)
+	require.NoError(t, err)
+
+	orders := NewOrderRepository(pool)
+	order := &models.Order{Number: fmt.Sprint(time.Now().UnixNano()), UserID: user.ID, Status: models.OrderStatusNew}
+	require.NoError(t, orders.CreateOrder(ctx, order, "upload"))
+
+	// Two workers race to process the order: the loser sees the status
+	// changed and nothing is credited twice.
+	amount := 729.98
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = orders.UpdateStatus(ctx, order.Number, models.OrderStatusNew, models.OrderStatusProcessed, &amount, "poll")
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, countErrors(errs, models.ErrOrderStatusChanged), "exactly one update wins")
+
+	// Replayed credits are absorbed by the unique index.
+	stored, err := orders.GetByNumber(ctx, order.Number)
+	require.NoError(t, err)
+	credited, err := orders.CreditAccrual(ctx, stored)
+	require.NoError(t, err)
+	assert.False(t, credited)
+	_, err = pool.Exec(ctx, queries.CreditOrderAccrual, user.ID, amount, order.Number)
+	require.NoError(t, err)
+
+	balance, err := NewLedgerRepository(pool).GetBalance(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, amount, balance.Current)
+
+	events, err := orders.ListEvents(ctx, stored.ID)
+	require.NoError(t, err)
+	assert.Len(t, events, 2)
+}
+
+func TestOrderRepository_CreateOrders(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+
+	users := NewUserRepository(pool)
+	login := fmt.Sprintf("batch_%d", time.Now().UnixNano())
+	require.NoError(t, users.CreateUser(ctx, &models.User{Login: login, Password: "x"}))
+	user, err := users.GetByLogin(ctx, login)
+	require.NoError(t, err)
+
+	orders := NewOrderRepository(pool)
+	prefix := fmt.Sprint(time.Now().UnixNano())
+	existing := &models.Order{Number: prefix + "0", UserID: user.ID, Status: models.OrderStatusNew}
+	require.NoError(t, orders.CreateOrder(ctx, existing, "upload"))
+
+	batch := []*models.Order{
+		{Number: prefix + "0", UserID: user.ID, Status: models.OrderStatusNew},
+		{Number: prefix + "1", UserID: user.ID, Status: models.OrderStatusNew},
+		{Number: prefix + "2", UserID: user.ID, Status: models.OrderStatusNew},
+	}
+	skipped, err := orders.CreateOrders(ctx, batch, "upload")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{prefix + "0": user.ID}, skipped)
+	assert.Zero(t, batch[0].ID)
+	assert.NotZero(t, batch[1].ID)
+	assert.NotZero(t, batch[2].ID)
+
+	events, err := orders.ListEvents(ctx, batch[1].ID)
+	require.NoError(t, err)
+	assert.Len(t, events, 1)
+}
+
+func countErrors(errs []error, target error) int {
+	var n int
+	for _, err := range errs {
+		if errors.Is(err, target) {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"github.com/rshafikov/gophermart/internal/models"
+	"sort"
+	"time"
+)
+
+// pageArgs returns the cursor time and ID, from, to and limit parameters of
+// the paginated listing queries, NULL for the unset ones.
+func pageArgs(q models.PageQuery) []any {
+	var (
+		afterAt *time.Time
+		afterID int
+		limit   *int
+	)
+	if q.After != nil {
+		afterAt, afterID = &q.After.At, q.After.ID
+	}
+	if q.Limit > 0 {
+		limit = &q.Limit
+	}
+	return []any{afterAt, afterID, q.From, q.To, limit}
+}
+
+// sortPage sorts items newest first and truncates them to limit, like the
+// paginated queries do.
+func sortPage[T any](items []T, key func(T) (time.Time, int), limit int) []T {
+	sort.Slice(items, func(i, j int) bool {
+		aAt, aID := key(items[i])
+		bAt, bID := key(items[j])
+		return newerFirst(aAt, aID, bAt, bID)
+	})
+	if limit > 0 && len(items) > limit {
+		items = items[:limit]
+	}
+	return items
+}
+
+func newerFirst(aAt time.Time, aID int, bAt time.Time, bID int) bool {
+	if aAt.Equal(bAt) {
+		return aID > bID
+	}
+	return aAt.After(bAt)
+}
@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rshafikov/gophermart/internal/database/queries"
+	"github.com/rshafikov/gophermart/internal/models"
+	"log"
+	"sync"
+	"time"
+)
+
+type TransferRepository struct {
+	Pool *pgxpool.Pool
+	// Expiry is written off before transfers, see expireDue.
+	Expiry models.ExpiryPolicy
+}
+
+func NewTransferRepository(pool *pgxpool.Pool) *TransferRepository {
+	return &TransferRepository{Pool: pool}
+}
+
+func (r *TransferRepository) Transfer(ctx context.Context, t *models.Transfer, dailyMax float64) error {
+	err := pgx.BeginFunc(ctx, r.Pool, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, queries.GetUserIDByLogin, t.RecipientLogin).Scan(&t.RecipientID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.ErrRecipientNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if t.RecipientID == t.SenderID {
+			return models.ErrSelfTransfer
+		}
+
+		if _, err := tx.Exec(ctx, queries.LockUser, t.SenderID); err != nil {
+			return err
+		}
+
+		if dailyMax > 0 {
+			var sent float64
+			if err := tx.QueryRow(ctx, queries.SumRecentTransfers, t.SenderID).Scan(&sent); err != nil {
+				return err
+			}
+			if models.RoundPoints(sent+t.Amount) > dailyMax {
+				return models.ErrTransferLimitExceeded
+			}
+		}
+
+		if err := expireDue(ctx, tx, r.Expiry, t.SenderID); err != nil {
+			return err
+		}
+		var ok bool
+		if err := tx.QueryRow(ctx, queries.HasFunds, t.SenderID, t.Amount).Scan(&ok); err != nil {
+			return err
+		}
+		if !ok {
+			return models.ErrInsufficientFunds
+		}
+
+		if err := tx.QueryRow(ctx, queries.CreateTransfer, t.SenderID, t.RecipientID, t.Amount).Scan(&t.ID, &t.CreatedAt); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, queries.PostTransfer, t.SenderID, t.RecipientID, t.Amount, t.ID, t.CreatedAt)
+		return err
+	})
+	if err != nil && !isTransferRejected(err) {
+		log.Println("unable to CREATE transfer:", err)
+	}
+	return err
+}
+
+func (r *TransferRepository) ListByUser(ctx context.Context, userID int, q models.PageQuery) ([]*models.Transfer, error) {
+	rows, err := r.Pool.Query(ctx, queries.ListTransfersByUser, append([]any{userID}, pageArgs(q)...)...)
+	if err != nil {
+		log.Println("unable to LIST transfers:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transfers []*models.Transfer
+	for rows.Next() {
+		var t models.Transfer
+		err := rows.Scan(&t.ID, &t.SenderID, &t.SenderLogin, &t.RecipientID, &t.RecipientLogin, &t.Amount, &t.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, &t)
+	}
+	return transfers, rows.Err()
+}
+
+func isTransferRejected(err error) bool {
+	return errors.Is(err, models.ErrRecipientNotFound) ||
+		errors.Is(err, models.ErrSelfTransfer) ||
+		errors.Is(err, models.ErrTransferLimitExceeded) ||
+		errors.Is(err, models.ErrInsufficientFunds)
+}
+
+// MockTransferRepository posts transfers to Ledger. Recipients are looked
+// up in Users, which maps logins to user IDs.
+type MockTransferRepository struct {
+	mu        sync.Mutex
+	Transfers []*models.Transfer
+	Users     map[string]int
+	Ledger    *MockLedgerRepository
+}
+
+func NewMockTransferRepository(ledger *MockLedgerRepository) *MockTransferRepository {
+	return &MockTransferRepository{Users: make(map[string]int), Ledger: ledger}
+}
+
+func (m *MockTransferRepository) Transfer(ctx context.Context, t *models.Transfer, dailyMax float64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	recipientID, ok := m.Users[t.RecipientLogin]
+	if !ok {
+		return models.ErrRecipientNotFound
+	}
+	if recipientID == t.SenderID {
+		return models.ErrSelfTransfer
+	}
+
+	now := time.Now()
+	if dailyMax > 0 {
+		sent := t.Amount
+		for _, prev := range m.Transfers {
+			if prev.SenderID == t.SenderID && prev.CreatedAt.After(now.Add(-24*time.Hour)) {
+				sent += prev.Amount
+			}
+		}
+		if models.RoundPoints(sent) > dailyMax {
+			return models.ErrTransferLimitExceeded
+		}
+	}
+
+	transferID := len(m.Transfers) + 1
+	err := m.Ledger.debit(models.LedgerEntry{
+		UserID: t.SenderID, Kind: models.LedgerTransferOut, Amount: -t.Amount, TransferID: &transferID, CreatedAt: now,
+	})
+	if err != nil {
+		return err
+	}
+	m.Ledger.credit(models.LedgerEntry{
+		UserID: recipientID, Kind: models.LedgerTransferIn, Amount: t.Amount, TransferID: &transferID, CreatedAt: now,
+	})
+
+	t.ID = transferID
+	t.RecipientID = recipientID
+	t.CreatedAt = now
+	for login, id := range m.Users {
+		if id == t.SenderID {
+			t.SenderLogin = login
+		}
+	}
+
+	cp := *t
+	m.Transfers = append(m.Transfers, &cp)
+	return nil
+}
+
+func (m *MockTransferRepository) ListByUser(ctx context.Context, userID int, q models.PageQuery) ([]*models.Transfer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var transfers []*models.Transfer
+	for _, t := range m.Transfers {
+		if (t.SenderID == userID || t.RecipientID == userID) && q.Includes(t.CreatedAt, t.ID) {
+			cp := *t
+			transfers = append(transfers, &cp)
+		}
+	}
+	transfers = sortPage(transfers, func(t *models.Transfer) (time.Time, int) { return t.CreatedAt, t.ID }, q.Limit)
+	return transfers, nil
+}
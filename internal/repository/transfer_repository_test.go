@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/rshafikov/gophermart/internal/database/queries"
+	"github.com/rshafikov/gophermart/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestTransferRepository_Transfer(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+
+	users := NewUserRepository(pool)
+	var ids []int
+	var logins []string
+	for _, name := range []string{"sender", "recipient"} {
+		login := fmt.Sprintf("%s_%d", name, time.Now().UnixNano())
+		require.NoError(t, users.CreateUser(ctx, &models.User{Login: login, Password: "x"}))
+		user, err := users.GetByLogin(ctx, login)
+		require.NoError(t, err)
+		ids = append(ids, user.ID)
+		logins = append(logins, login)
+	}
+
+	orders := NewOrderRepository(pool)
+	order := &models.Order{Number: fmt.Sprint(time.Now().UnixNano()), UserID: ids[0], Status: models.OrderStatusNew}
+	require.NoError(t, orders.CreateOrder(ctx, order, "upload"))
+	_, err := pool.Exec(ctx, queries.CreditOrderAccrual, ids[0], 100, order.Number)
+	require.NoError(t, err)
+
+	transfers := NewTransferRepository(pool)
+	require.NoError(t, transfers.Transfer(ctx, &models.Transfer{SenderID: ids[0], RecipientLogin: logins[1], Amount: 40}, 50))
+	err = transfers.Transfer(ctx, &models.Transfer{SenderID: ids[0], RecipientLogin: logins[1], Amount: 20}, 50)
+	assert.ErrorIs(t, err, models.ErrTransferLimitExceeded)
+	require.NoError(t, transfers.Transfer(ctx, &models.Transfer{SenderID: ids[0], RecipientLogin: logins[1], Amount: 0.1}, 40.3))
+	require.NoError(t, transfers.Transfer(ctx, &models.Transfer{SenderID: ids[0], RecipientLogin: logins[1], Amount: 0.2}, 40.3), "the limit is compared in cents")
+	err = transfers.Transfer(ctx, &models.Transfer{SenderID: ids[1], RecipientLogin: logins[1], Amount: 1}, 0)
+	assert.ErrorIs(t, err, models.ErrSelfTransfer)
+	err = transfers.Transfer(ctx, &models.Transfer{SenderID: ids[1], RecipientLogin: logins[0], Amount: 41}, 0)
+	assert.ErrorIs(t, err, models.ErrInsufficientFunds)
+
+	ledger := NewLedgerRepository(pool)
+	for i, want := range []float64{59.7, 40.3} {
+		balance, err := ledger.GetBalance(ctx, ids[i])
+		require.NoError(t, err)
+		assert.Equal(t, want, balance.Current)
+		assert.Zero(t, balance.Withdrawn)
+	}
+
+	listed, err := transfers.ListByUser(ctx, ids[1], models.PageQuery{})
+	require.NoError(t, err)
+	require.Len(t, listed, 3)
+	assert.Equal(t, logins[0], listed[0].SenderLogin)
+}
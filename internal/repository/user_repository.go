@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/rshafikov/gophermart/internal/core/security"
@@ -20,7 +21,10 @@ func NewUserRepository(pool *pgxpool.Pool) *UserRepository {
 }
 
 func (r *UserRepository) CreateUser(ctx context.Context, user *models.User) error {
-	exec, err := r.Pool.Exec(ctx, queries.CreateUser, user.Login, user.Password)
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
+	exec, err := r.Pool.Exec(ctx, queries.CreateUser, user.Login, user.Password, user.Role)
 	if err != nil {
 		log.Println("unable to CREATE user:", err)
 		return err
@@ -33,7 +37,7 @@ func (r *UserRepository) GetByLogin(ctx context.Context, login string) (*models.
 	var user models.User
 
 	q := r.Pool.QueryRow(ctx, queries.GetUserByLogin, login)
-	err := q.Scan(&user.ID, &user.Login, &user.Password, &user.CreatedAt)
+	err := q.Scan(&user.ID, &user.Login, &user.Password, &user.Role, &user.CreatedAt)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			log.Printf("there is no user with login '%s'", login)
@@ -45,16 +49,46 @@ func (r *UserRepository) GetByLogin(ctx context.Context, login string) (*models.
 	return &user, nil
 }
 
+func (r *UserRepository) SetRole(ctx context.Context, login string, role models.Role, audit *models.AuditEntry) error {
+	err := pgx.BeginFunc(ctx, r.Pool, func(tx pgx.Tx) error {
+		if err := tx.QueryRow(ctx, queries.SetUserRole, login, role).Scan(&audit.UserID); err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, audit)
+	})
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Println("unable to UPDATE user role:", err)
+	}
+	return err
+}
+
+func (r *UserRepository) Anonymize(ctx context.Context, userID int) error {
+	tag, err := r.Pool.Exec(ctx, queries.AnonymizeUser, userID)
+	if err != nil {
+		log.Println("unable to ANONYMIZE user:", err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// MockUserRepository records role changes to Audit.
 type MockUserRepository struct {
-	DB map[string]*models.User
+	DB    map[string]*models.User
+	Audit *MockAuditRepository
 }
 
 func NewMockUserRepository() models.UserRepository {
-	return &MockUserRepository{DB: make(map[string]*models.User)}
+	return &MockUserRepository{DB: make(map[string]*models.User), Audit: NewMockAuditRepository()}
 }
 
 func (m *MockUserRepository) CreateUser(ctx context.Context, user *models.User) error {
 	user.Password, _ = security.HashPassword(user.Password)
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
 	m.DB[user.Login] = user
 	return nil
 }
@@ -67,6 +101,31 @@ func (m *MockUserRepository) GetByLogin(ctx context.Context, login string) (*mod
 	return user, nil
 }
 
+func (m *MockUserRepository) SetRole(ctx context.Context, login string, role models.Role, audit *models.AuditEntry) error {
+	user, ok := m.DB[login]
+	if !ok {
+		return errors.New("user not found")
+	}
+	user.Role = role
+	audit.UserID = user.ID
+	m.Audit.record(audit)
+	return nil
+}
+
+func (m *MockUserRepository) Anonymize(ctx context.Context, userID int) error {
+	for login, user := range m.DB {
+		if user.ID != userID {
+			continue
+		}
+		delete(m.DB, login)
+		user.Login = fmt.Sprintf("deleted-%d", userID)
+		user.Password = ""
+		m.DB[user.Login] = user
+		return nil
+	}
+	return errors.New("user not found")
+}
+
 func (m *MockUserRepository) Clear() {
 	m.DB = make(map[string]*models.User)
 }
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/rshafikov/gophermart/internal/database/queries"
+	"github.com/rshafikov/gophermart/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestUserRepository_Anonymize(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+
+	users := NewUserRepository(pool)
+	login := fmt.Sprintf("gone_%d", time.Now().UnixNano()%1e9)
+	require.NoError(t, users.CreateUser(ctx, &models.User{Login: login, Password: "x"}))
+	user, err := users.GetByLogin(ctx, login)
+	require.NoError(t, err)
+	_, err = pool.Exec(ctx, queries.CreditOrderAccrual, user.ID, 100, fmt.Sprint(time.Now().UnixNano()))
+	require.NoError(t, err)
+
+	require.NoError(t, users.Anonymize(ctx, user.ID))
+	assert.ErrorIs(t, users.Anonymize(ctx, user.ID), pgx.ErrNoRows, "already deleted")
+
+	// The anonymized login, shown in the transfer history of counterparts,
+	// cannot receive transfers.
+	var anonymized string
+	require.NoError(t, pool.QueryRow(ctx, "SELECT login FROM users WHERE id = $1", user.ID).Scan(&anonymized))
+	var id int
+	err = pool.QueryRow(ctx, queries.GetUserIDByLogin, anonymized).Scan(&id)
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+	// The login can be registered again while the ledger stays with the
+	// anonymized account.
+	_, err = users.GetByLogin(ctx, login)
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+	require.NoError(t, users.CreateUser(ctx, &models.User{Login: login, Password: "x"}))
+
+	balance, err := NewLedgerRepository(pool).GetBalance(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 100.0, balance.Current)
+}
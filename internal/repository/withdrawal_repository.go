@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rshafikov/gophermart/internal/database/queries"
+	"github.com/rshafikov/gophermart/internal/models"
+	"log"
+	"sync"
+	"time"
+)
+
+type WithdrawalRepository struct {
+	Pool *pgxpool.Pool
+	// Expiry is written off before withdrawals, see expireDue.
+	Expiry models.ExpiryPolicy
+}
+
+func NewWithdrawalRepository(pool *pgxpool.Pool) *WithdrawalRepository {
+	return &WithdrawalRepository{Pool: pool}
+}
+
+func (r *WithdrawalRepository) Withdraw(ctx context.Context, w *models.Withdrawal) error {
+	err := pgx.BeginFunc(ctx, r.Pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, queries.LockUser, w.UserID); err != nil {
+			return err
+		}
+		if err := expireDue(ctx, tx, r.Expiry, w.UserID); err != nil {
+			return err
+		}
+
+		var ok bool
+		if err := tx.QueryRow(ctx, queries.HasFunds, w.UserID, w.Sum).Scan(&ok); err != nil {
+			return err
+		}
+		if !ok {
+			return models.ErrInsufficientFunds
+		}
+
+		err := tx.QueryRow(ctx, queries.CreateWithdrawal, w.UserID, w.Order, w.Sum).Scan(&w.ID, &w.ProcessedAt)
+		if err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+				return models.ErrWithdrawalExists
+			}
+			return err
+		}
+
+		_, err = tx.Exec(ctx, queries.DebitWithdrawal, w.UserID, w.Sum, w.Order, w.ProcessedAt)
+		return err
+	})
+	if err != nil && !errors.Is(err, models.ErrInsufficientFunds) && !errors.Is(err, models.ErrWithdrawalExists) {
+		log.Println("unable to CREATE withdrawal:", err)
+	}
+	return err
+}
+
+func (r *WithdrawalRepository) ListByUser(ctx context.Context, userID int, q models.PageQuery) ([]*models.Withdrawal, error) {
+	rows, err := r.Pool.Query(ctx, queries.ListWithdrawalsByUser, append([]any{userID}, pageArgs(q)...)...)
+	if err != nil {
+		log.Println("unable to LIST withdrawals:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var withdrawals []*models.Withdrawal
+	for rows.Next() {
+		var w models.Withdrawal
+		if err := rows.Scan(&w.ID, &w.UserID, &w.Order, &w.Sum, &w.ProcessedAt, &w.RefundedAt, &w.RefundReason); err != nil {
+			return nil, err
+		}
+		withdrawals = append(withdrawals, &w)
+	}
+	return withdrawals, rows.Err()
+}
+
+func (r *WithdrawalRepository) Refund(ctx context.Context, order, reason string, audit *models.AuditEntry) (*models.Withdrawal, error) {
+	var w models.Withdrawal
+	err := pgx.BeginFunc(ctx, r.Pool, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, queries.RefundWithdrawal, order, reason).Scan(
+			&w.ID, &w.UserID, &w.Order, &w.Sum, &w.ProcessedAt, &w.RefundedAt, &w.RefundReason,
+		)
+		if errors.Is(err, pgx.ErrNoRows) {
+			var exists bool
+			if err := tx.QueryRow(ctx, queries.WithdrawalExists, order).Scan(&exists); err != nil {
+				return err
+			}
+			if exists {
+				return models.ErrWithdrawalRefunded
+			}
+			return models.ErrWithdrawalNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, queries.CreditRefund, w.UserID, w.Sum, w.Order, w.RefundedAt); err != nil {
+			return err
+		}
+
+		audit.UserID = w.UserID
+		return recordAudit(ctx, tx, audit)
+	})
+	if err != nil {
+		if !errors.Is(err, models.ErrWithdrawalNotFound) && !errors.Is(err, models.ErrWithdrawalRefunded) {
+			log.Println("unable to REFUND withdrawal:", err)
+		}
+		return nil, err
+	}
+	return &w, nil
+}
+
+// MockWithdrawalRepository debits withdrawals from Ledger.
+type MockWithdrawalRepository struct {
+	mu          sync.Mutex
+	Withdrawals []*models.Withdrawal
+	Ledger      *MockLedgerRepository
+}
+
+func NewMockWithdrawalRepository(ledger *MockLedgerRepository) *MockWithdrawalRepository {
+	return &MockWithdrawalRepository{Ledger: ledger}
+}
+
+func (m *MockWithdrawalRepository) Withdraw(ctx context.Context, w *models.Withdrawal) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.Withdrawals {
+		if existing.Order == w.Order {
+			return models.ErrWithdrawalExists
+		}
+	}
+
+	w.ID = len(m.Withdrawals) + 1
+	w.ProcessedAt = time.Now()
+	order := w.Order
+	err := m.Ledger.debit(models.LedgerEntry{
+		UserID: w.UserID, Kind: models.LedgerWithdrawal, Amount: -w.Sum, OrderNumber: &order, CreatedAt: w.ProcessedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	cp := *w
+	m.Withdrawals = append(m.Withdrawals, &cp)
+	return nil
+}
+
+func (m *MockWithdrawalRepository) ListByUser(ctx context.Context, userID int, q models.PageQuery) ([]*models.Withdrawal, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var withdrawals []*models.Withdrawal
+	for _, w := range m.Withdrawals {
+		if w.UserID == userID && q.Includes(w.ProcessedAt, w.ID) {
+			cp := *w
+			withdrawals = append(withdrawals, &cp)
+		}
+	}
+	withdrawals = sortPage(withdrawals, func(w *models.Withdrawal) (time.Time, int) { return w.ProcessedAt, w.ID }, q.Limit)
+	return withdrawals, nil
+}
+
+func (m *MockWithdrawalRepository) Refund(ctx context.Context, order, reason string, audit *models.AuditEntry) (*models.Withdrawal, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, w := range m.Withdrawals {
+		if w.Order != order {
+			continue
+		}
+		if w.Refunded() {
+			return nil, models.ErrWithdrawalRefunded
+		}
+		now := time.Now()
+		w.RefundedAt = &now
+		w.RefundReason = reason
+		order := w.Order
+		m.Ledger.credit(models.LedgerEntry{
+			UserID: w.UserID, Kind: models.LedgerRefund, Amount: w.Sum, OrderNumber: &order, CreatedAt: now,
+		})
+		audit.UserID = w.UserID
+		m.Ledger.Audit.record(audit)
+		cp := *w
+		return &cp, nil
+	}
+	return nil, models.ErrWithdrawalNotFound
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/rshafikov/gophermart/internal/database/queries"
+	"github.com/rshafikov/gophermart/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWithdrawalRepository_RefundsOnce(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+
+	users := NewUserRepository(pool)
+	login := fmt.Sprintf("refund_%d", time.Now().UnixNano())
+	require.NoError(t, users.CreateUser(ctx, &models.User{Login: login, Password: "x"}))
+	user, err := users.GetByLogin(ctx, login)
+	require.NoError(t, err)
+
+	orders := NewOrderRepository(pool)
+	order := &models.Order{Number: fmt.Sprint(time.Now().UnixNano()), UserID: user.ID, Status: models.OrderStatusNew}
+	require.NoError(t, orders.CreateOrder(ctx, order, "upload"))
+	_, err = pool.Exec(ctx, queries.CreditOrderAccrual, user.ID, 100, order.Number)
+	require.NoError(t, err)
+
+	withdrawals := NewWithdrawalRepository(pool)
+	w := &models.Withdrawal{UserID: user.ID, Order: fmt.Sprint(time.Now().UnixNano()), Sum: 60}
+	require.NoError(t, withdrawals.Withdraw(ctx, w))
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			audit := &models.AuditEntry{ActorID: user.ID, Action: models.AuditRefund, Reason: "order cancelled"}
+			_, errs[i] = withdrawals.Refund(ctx, w.Order, "order cancelled", audit)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, countErrors(errs, models.ErrWithdrawalRefunded), "exactly one refund wins")
+
+	_, err = withdrawals.Refund(ctx, "0", "order cancelled", &models.AuditEntry{ActorID: user.ID, Action: models.AuditRefund})
+	assert.ErrorIs(t, err, models.ErrWithdrawalNotFound)
+
+	balance, err := NewLedgerRepository(pool).GetBalance(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, &models.Balance{Current: 100, Withdrawn: 0}, balance)
+
+	listed, err := withdrawals.ListByUser(ctx, user.ID, models.PageQuery{})
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	assert.True(t, listed[0].Refunded())
+	assert.Equal(t, "order cancelled", listed[0].RefundReason)
+
+	// Only the refund that went through is audited, and the log cannot be
+	// rewritten.
+	audit, err := NewAuditRepository(pool).List(ctx, models.AuditQuery{UserID: &user.ID})
+	require.NoError(t, err)
+	require.Len(t, audit, 1)
+	assert.Equal(t, login, audit[0].User)
+	assert.Equal(t, models.AuditRefund, audit[0].Action)
+	_, err = pool.Exec(ctx, "DELETE FROM audit_log WHERE id = $1", audit[0].ID)
+	assert.Error(t, err)
+}
+
+func TestWithdrawalRepository_WritesOffExpiredPoints(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+
+	users := NewUserRepository(pool)
+	login := fmt.Sprintf("expiry_%d", time.Now().UnixNano())
+	require.NoError(t, users.CreateUser(ctx, &models.User{Login: login, Password: "x"}))
+	user, err := users.GetByLogin(ctx, login)
+	require.NoError(t, err)
+
+	// Credited before the expiry period, not yet written off by the expirer.
+	_, err = pool.Exec(ctx, "INSERT INTO ledger_entries (user_id, kind, amount, created_at) VALUES ($1, 'ADJUSTMENT', 100, $2)",
+		user.ID, time.Now().AddDate(0, -4, 0))
+	require.NoError(t, err)
+	_, err = pool.Exec(ctx, "INSERT INTO ledger_entries (user_id, kind, amount) VALUES ($1, 'ADJUSTMENT', 50)", user.ID)
+	require.NoError(t, err)
+
+	withdrawals := NewWithdrawalRepository(pool)
+	withdrawals.Expiry = models.ExpiryPolicy{Months: 3}
+	err = withdrawals.Withdraw(ctx, &models.Withdrawal{UserID: user.ID, Order: fmt.Sprint(time.Now().UnixNano()), Sum: 60})
+	assert.ErrorIs(t, err, models.ErrInsufficientFunds)
+	require.NoError(t, withdrawals.Withdraw(ctx, &models.Withdrawal{UserID: user.ID, Order: fmt.Sprint(time.Now().UnixNano()), Sum: 40}))
+
+	balance, err := NewLedgerRepository(pool).GetBalance(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, &models.Balance{Current: 10, Withdrawn: 40}, balance)
+}
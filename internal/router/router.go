@@ -4,43 +4,122 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/rshafikov/gophermart/internal/core/security"
+	"github.com/rshafikov/gophermart/internal/core/tracing"
 	"github.com/rshafikov/gophermart/internal/handlers"
 	"github.com/rshafikov/gophermart/internal/middlewares"
+	"github.com/rshafikov/gophermart/internal/models"
 	"github.com/rshafikov/gophermart/internal/service"
-	"net/http"
+	"time"
 )
 
 type Router struct {
-	UserService *service.UserService
-	JWT         security.JWTHandler
+	UserService     *service.UserService
+	OrderService    *service.OrderService
+	BalanceService  *service.BalanceService
+	TransferService *service.TransferService
+	AuditService    *service.AuditService
+	JWT             security.JWTHandler
+	// PublicLimiter and UserLimiter throttle the anonymous and the authenticated
+	// route groups respectively; nil disables limiting for the group.
+	// UserLimiter runs once the user is known, after the token has been
+	// checked against the database, so AuthLimiter throttles the
+	// authenticated routes per IP before that.
+	PublicLimiter *middlewares.RateLimiter
+	UserLimiter   *middlewares.RateLimiter
+	AuthLimiter   *middlewares.RateLimiter
+	// AccrualCallbackSecret enables POST /internal/accrual/callback when set.
+	AccrualCallbackSecret  []byte
+	AccrualCallbackMaxSkew time.Duration
+	// IdempotencyKeys enables Idempotency-Key support on the mutating user
+	// routes when set. Responses are kept for IdempotencyTTL.
+	IdempotencyKeys models.IdempotencyRepository
+	IdempotencyTTL  time.Duration
 }
 
-func NewRouter(userService *service.UserService, jwtService security.JWTHandler) *Router {
-	return &Router{UserService: userService, JWT: jwtService}
+func NewRouter(
+	userService *service.UserService,
+	orderService *service.OrderService,
+	balanceService *service.BalanceService,
+	jwtService security.JWTHandler,
+) *Router {
+	return &Router{UserService: userService, OrderService: orderService, BalanceService: balanceService, JWT: jwtService}
 }
 
 func (mr *Router) Routes() chi.Router {
 	r := chi.NewRouter()
 
+	r.Use(tracing.Middleware)
 	r.Use(middlewares.Logger)
 	r.Use(middleware.Recoverer)
 
 	userHandler := handlers.NewUserHandler(mr.UserService, mr.JWT)
+	orderHandler := handlers.NewOrderHandler(mr.OrderService)
+	balanceHandler := handlers.NewBalanceHandler(mr.BalanceService)
+	transferHandler := handlers.NewTransferHandler(mr.TransferService)
+	accountHandler := handlers.NewAccountHandler(mr.UserService, mr.OrderService, mr.BalanceService)
+	adminHandler := handlers.NewAdminHandler(mr.UserService, mr.OrderService, mr.BalanceService, mr.AuditService)
 
 	r.Route("/api", func(r chi.Router) {
 		r.Route("/user", func(r chi.Router) {
-			r.Post("/register", userHandler.Register)
-			r.Post("/login", userHandler.Login)
 			r.Group(func(r chi.Router) {
+				if mr.PublicLimiter != nil {
+					r.Use(mr.PublicLimiter.Middleware)
+				}
+				r.Post("/register", userHandler.Register)
+				r.Post("/login", userHandler.Login)
+			})
+			r.Group(func(r chi.Router) {
+				if mr.AuthLimiter != nil {
+					r.Use(mr.AuthLimiter.Middleware)
+				}
 				r.Use(middlewares.Authenticater(mr.JWT, mr.UserService))
-				r.Post("/orders", userHandler.CreateOrder)
-				r.Get("/orders", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
-				r.Get("/balance", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
-				r.Post("/balance/withdraw", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
-				r.Get("/withdrawals", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+				if mr.UserLimiter != nil {
+					r.Use(mr.UserLimiter.Middleware)
+				}
+				r.Get("/orders", orderHandler.ListOrders)
+				r.Get("/orders/{number}", orderHandler.GetOrder)
+				r.Get("/orders/{number}/history", orderHandler.OrderHistory)
+				r.Get("/balance", balanceHandler.GetBalance)
+				r.Get("/withdrawals", balanceHandler.ListWithdrawals)
+				r.Get("/transactions", balanceHandler.ListTransactions)
+				r.Group(func(r chi.Router) {
+					if mr.IdempotencyKeys != nil {
+						r.Use(middlewares.Idempotency(mr.IdempotencyKeys, mr.IdempotencyTTL))
+					}
+					r.Post("/orders", orderHandler.CreateOrder)
+					r.Post("/orders/batch", orderHandler.CreateOrderBatch)
+					r.Post("/balance/withdraw", balanceHandler.Withdraw)
+					r.Post("/balance/transfer", transferHandler.Transfer)
+				})
+				r.Get("/transfers", transferHandler.ListTransfers)
+				r.Get("/me", accountHandler.Me)
+				r.Get("/export", accountHandler.Export)
+				r.Delete("/", accountHandler.Delete)
 			})
 		})
+
+		r.Route("/admin", func(r chi.Router) {
+			if mr.AuthLimiter != nil {
+				r.Use(mr.AuthLimiter.Middleware)
+			}
+			r.Use(middlewares.Authenticater(mr.JWT, mr.UserService))
+			r.Use(middlewares.RequireRole(models.RoleSupport, models.RoleAdmin))
+			r.Get("/users/{login}", adminHandler.GetUser)
+			r.Get("/users/{login}/orders", adminHandler.ListOrders)
+			r.Get("/users/{login}/balance", adminHandler.GetBalance)
+			r.Get("/users/{login}/transactions", adminHandler.ListTransactions)
+			r.Post("/users/{login}/adjustments", adminHandler.Adjust)
+			r.Post("/withdrawals/{order}/refund", adminHandler.RefundWithdrawal)
+			r.Get("/audit", adminHandler.ListAudit)
+			r.With(middlewares.RequireRole(models.RoleAdmin)).Put("/users/{login}/role", adminHandler.SetRole)
+		})
 	})
 
+	if len(mr.AccrualCallbackSecret) > 0 {
+		callbackHandler := handlers.NewAccrualCallbackHandler(mr.OrderService)
+		r.With(middlewares.SignatureVerifier(mr.AccrualCallbackSecret, mr.AccrualCallbackMaxSkew)).
+			Post("/internal/accrual/callback", callbackHandler.Callback)
+	}
+
 	return r
 }
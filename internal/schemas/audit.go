@@ -0,0 +1,13 @@
+package schemas
+
+import "time"
+
+type AuditEntryResponse struct {
+	ID        int            `json:"id"`
+	Actor     string         `json:"actor"`
+	User      string         `json:"user"`
+	Action    string         `json:"action"`
+	Reason    string         `json:"reason,omitempty"`
+	Details   map[string]any `json:"details,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+}
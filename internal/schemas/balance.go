@@ -0,0 +1,63 @@
+package schemas
+
+import "time"
+
+type BalanceResponse struct {
+	Current   float64 `json:"current"`
+	Withdrawn float64 `json:"withdrawn"`
+	// Expiring is only reported when points expire.
+	Expiring []ExpiringPointsResponse `json:"expiring,omitempty"`
+	// Pending is only reported with ?details=true.
+	Pending *PendingOrdersResponse `json:"pending,omitempty"`
+}
+
+// PendingOrdersResponse counts the orders whose points are on the way.
+type PendingOrdersResponse struct {
+	Orders     int `json:"orders"`
+	New        int `json:"new"`
+	Processing int `json:"processing"`
+}
+
+type ExpiringPointsResponse struct {
+	Amount    float64   `json:"amount"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type WithdrawRequest struct {
+	Order string  `json:"order"`
+	Sum   float64 `json:"sum"`
+}
+
+// Withdrawal statuses reported in WithdrawalResponse.
+const (
+	WithdrawalProcessed = "PROCESSED"
+	WithdrawalRefunded  = "REFUNDED"
+)
+
+type WithdrawalResponse struct {
+	Order       string     `json:"order"`
+	Sum         float64    `json:"sum"`
+	ProcessedAt time.Time  `json:"processed_at"`
+	Status      string     `json:"status"`
+	RefundedAt  *time.Time `json:"refunded_at,omitempty"`
+}
+
+type RefundRequest struct {
+	Reason string `json:"reason"`
+}
+
+type TransactionResponse struct {
+	ID          int       `json:"id"`
+	Type        string    `json:"type"`
+	Amount      float64   `json:"amount"`
+	Balance     float64   `json:"balance"`
+	Order       *string   `json:"order,omitempty"`
+	Counterpart *string   `json:"counterpart,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type AdjustmentRequest struct {
+	Amount float64 `json:"amount"`
+	Reason string  `json:"reason"`
+}
@@ -0,0 +1,28 @@
+package schemas
+
+import "time"
+
+type OrderResponse struct {
+	Number     string    `json:"number"`
+	Status     string    `json:"status"`
+	Accrual    *float64  `json:"accrual,omitempty"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+type OrderDetailResponse struct {
+	OrderResponse
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type OrderEventResponse struct {
+	From      *string   `json:"from,omitempty"`
+	To        string    `json:"to"`
+	Accrual   *float64  `json:"accrual,omitempty"`
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type OrderUploadResult struct {
+	Number string `json:"number"`
+	Result string `json:"result"`
+}
@@ -0,0 +1,22 @@
+package schemas
+
+import "time"
+
+type TransferRequest struct {
+	Recipient string  `json:"recipient"`
+	Amount    float64 `json:"amount"`
+}
+
+// Transfer directions as seen by the requesting user.
+const (
+	TransferSent     = "sent"
+	TransferReceived = "received"
+)
+
+type TransferResponse struct {
+	ID          int       `json:"id"`
+	Direction   string    `json:"direction"`
+	Counterpart string    `json:"counterpart"`
+	Amount      float64   `json:"amount"`
+	CreatedAt   time.Time `json:"created_at"`
+}
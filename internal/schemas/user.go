@@ -1,10 +1,40 @@
 package schemas
 
+import "time"
+
 type UserCreate struct {
 	Login    string `json:"login"`
 	Password string `json:"password"`
 }
 
-type UserCreateResponse struct {
-	Login string `json:"login"`
+// UserResponse describes the account of a user.
+type UserResponse struct {
+	ID        int       `json:"id"`
+	Login     string    `json:"login"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ProfileResponse is what GET /api/user/me tells the user about themselves.
+type ProfileResponse struct {
+	UserResponse
+	Balance BalanceResponse `json:"balance"`
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+// AccountExport is the archive of the personal data kept about a user.
+type AccountExport struct {
+	Profile      UserResponse          `json:"profile"`
+	Orders       []OrderResponse       `json:"orders"`
+	Withdrawals  []WithdrawalResponse  `json:"withdrawals"`
+	Transactions []TransactionResponse `json:"transactions"`
+	ExportedAt   time.Time             `json:"exported_at"`
+}
+
+type RoleRequest struct {
+	Role   string `json:"role"`
+	Reason string `json:"reason"`
 }
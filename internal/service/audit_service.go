@@ -0,0 +1,38 @@
+package service
+
+import (
+	"context"
+	"github.com/rshafikov/gophermart/internal/core/tracing"
+	"github.com/rshafikov/gophermart/internal/models"
+)
+
+// AuditService reads the audit log written by the admin actions of the
+// other services.
+type AuditService struct {
+	repo models.AuditRepository
+}
+
+func NewAuditService(repo models.AuditRepository) *AuditService {
+	return &AuditService{repo: repo}
+}
+
+// List returns a page of the audit log, newest first, and the cursor of the
+// next page if there is one.
+func (s *AuditService) List(ctx context.Context, q models.AuditQuery) (_ []*models.AuditEntry, _ *models.PageCursor, err error) {
+	ctx, span := tracing.Start(ctx, "AuditService.List")
+	defer func() { tracing.End(span, err) }()
+
+	limit := q.Limit
+	if limit > 0 {
+		q.Limit++
+	}
+	entries, err := s.repo.List(ctx, q)
+	if err != nil {
+		return nil, nil, ErrDB
+	}
+
+	entries, next := page(entries, limit, func(e *models.AuditEntry) models.PageCursor {
+		return models.PageCursor{At: e.CreatedAt, ID: e.ID}
+	})
+	return entries, next, nil
+}
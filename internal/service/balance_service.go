@@ -0,0 +1,245 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/rshafikov/gophermart/internal/core/logger"
+	"github.com/rshafikov/gophermart/internal/core/luhn"
+	"github.com/rshafikov/gophermart/internal/core/tracing"
+	"github.com/rshafikov/gophermart/internal/models"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+)
+
+var ErrInvalidSum = errors.New("sum must be a positive amount with at most two decimal places")
+var ErrInsufficientFunds = errors.New("insufficient funds")
+var ErrWithdrawalExists = errors.New("withdrawal for this order already exists")
+var ErrWithdrawalNotFound = errors.New("withdrawal not found")
+var ErrWithdrawalRefunded = errors.New("withdrawal is already refunded")
+var ErrReasonRequired = errors.New("reason is required")
+var ErrInvalidAmount = errors.New("amount must be a non-zero number of points with at most two decimals")
+var ErrSelfAdjustment = errors.New("own balance may not be adjusted")
+var ErrStaffAdjustment = errors.New("only admins may adjust the balances of staff")
+
+type BalanceService struct {
+	repo        models.LedgerRepository
+	withdrawals models.WithdrawalRepository
+	orders      models.OrderRepository
+	// Expiry is the points expiration policy; the zero value keeps points
+	// forever.
+	Expiry models.ExpiryPolicy
+}
+
+func NewBalanceService(repo models.LedgerRepository, withdrawals models.WithdrawalRepository, orders models.OrderRepository) *BalanceService {
+	return &BalanceService{repo: repo, withdrawals: withdrawals, orders: orders}
+}
+
+func (s *BalanceService) GetBalance(ctx context.Context, userID int) (_ *models.Balance, err error) {
+	ctx, span := tracing.Start(ctx, "BalanceService.GetBalance")
+	defer func() { tracing.End(span, err) }()
+
+	balance, err := s.repo.GetBalance(ctx, userID)
+	if err != nil {
+		return nil, ErrDB
+	}
+
+	if s.Expiry.Enabled() {
+		entries, err := s.repo.ListEntries(ctx, userID)
+		if err != nil {
+			return nil, ErrDB
+		}
+		balance.Expiring = models.Upcoming(s.Expiry.Lots(entries), time.Now())
+	}
+	return balance, nil
+}
+
+// Adjust credits, or debits if the amount is negative, the user's balance
+// by hand on behalf of the actor. A debit may not overdraw the balance.
+// Nobody may adjust their own balance, and only admins may adjust the
+// balances of support and admin accounts.
+func (s *BalanceService) Adjust(ctx context.Context, actor, user *models.User, amount float64, reason string) (_ *models.LedgerEntry, err error) {
+	ctx, span := tracing.Start(ctx, "BalanceService.Adjust")
+	defer func() { tracing.End(span, err) }()
+
+	if actor.ID == user.ID {
+		return nil, ErrSelfAdjustment
+	}
+	if actor.Role != models.RoleAdmin && user.Role != models.RoleUser {
+		return nil, ErrStaffAdjustment
+	}
+	if amount == 0 || models.RoundPoints(amount) != amount {
+		return nil, ErrInvalidAmount
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ErrReasonRequired
+	}
+
+	e := &models.LedgerEntry{UserID: user.ID, Amount: amount, Reason: reason}
+	audit := &models.AuditEntry{
+		ActorID: actor.ID,
+		UserID:  user.ID,
+		Action:  models.AuditAdjustment,
+		Reason:  reason,
+		Details: map[string]any{"amount": amount},
+	}
+	err = s.repo.Adjust(ctx, e, audit)
+	switch {
+	case errors.Is(err, models.ErrInsufficientFunds):
+		return nil, ErrInsufficientFunds
+	case err != nil:
+		return nil, ErrDB
+	}
+	return e, nil
+}
+
+// ListTransactions returns a page of the user's ledger entries, newest
+// first, and the cursor of the next page if there is one.
+func (s *BalanceService) ListTransactions(ctx context.Context, userID int, q models.TransactionQuery) (_ []*models.Transaction, _ *models.PageCursor, err error) {
+	ctx, span := tracing.Start(ctx, "BalanceService.ListTransactions")
+	defer func() { tracing.End(span, err) }()
+
+	limit := q.Limit
+	if limit > 0 {
+		q.Limit++
+	}
+	transactions, err := s.repo.ListTransactions(ctx, userID, q)
+	if err != nil {
+		return nil, nil, ErrDB
+	}
+
+	transactions, next := page(transactions, limit, func(t *models.Transaction) models.PageCursor {
+		return models.PageCursor{At: t.CreatedAt, ID: t.ID}
+	})
+	return transactions, next, nil
+}
+
+// GetPendingOrders counts the user's orders whose accrual is not known yet.
+func (s *BalanceService) GetPendingOrders(ctx context.Context, userID int) (_ *models.PendingOrders, err error) {
+	ctx, span := tracing.Start(ctx, "BalanceService.GetPendingOrders")
+	defer func() { tracing.End(span, err) }()
+
+	counts, err := s.orders.CountByStatus(ctx, userID)
+	if err != nil {
+		return nil, ErrDB
+	}
+	return &models.PendingOrders{
+		New:        counts[models.OrderStatusNew],
+		Processing: counts[models.OrderStatusProcessing],
+	}, nil
+}
+
+// ExpirePoints debits the points that have expired by now from every user
+// and returns the total. It is safe to run concurrently and repeatedly:
+// expired points are only debited once.
+func (s *BalanceService) ExpirePoints(ctx context.Context, now time.Time) (_ float64, err error) {
+	ctx, span := tracing.Start(ctx, "BalanceService.ExpirePoints")
+	defer func() { tracing.End(span, err) }()
+
+	if !s.Expiry.Enabled() {
+		return 0, nil
+	}
+
+	userIDs, err := s.repo.ListUsersWithExpiredCredits(ctx, s.Expiry, now)
+	if err != nil {
+		return 0, ErrDB
+	}
+
+	due := func(entries []*models.LedgerEntry) float64 {
+		return s.Expiry.Due(entries, now)
+	}
+
+	var total float64
+	for _, userID := range userIDs {
+		if ctx.Err() != nil {
+			return total, ctx.Err()
+		}
+		expired, err := s.repo.Expire(ctx, userID, now, due)
+		if err != nil {
+			logger.L.Warn("unable to expire points", zap.Int("user", userID), zap.Error(err))
+			continue
+		}
+		if expired > 0 {
+			logger.L.Debug("points expired", zap.Int("user", userID), zap.Float64("amount", expired))
+			total += expired
+		}
+	}
+	return models.RoundPoints(total), nil
+}
+
+func (s *BalanceService) Withdraw(ctx context.Context, userID int, order string, sum float64) (_ *models.Withdrawal, err error) {
+	ctx, span := tracing.Start(ctx, "BalanceService.Withdraw", attribute.String("order.number", order))
+	defer func() { tracing.End(span, err) }()
+
+	if !luhn.Valid(order) {
+		return nil, ErrInvalidOrderNumber
+	}
+	if sum <= 0 || models.RoundPoints(sum) != sum {
+		return nil, ErrInvalidSum
+	}
+
+	w := &models.Withdrawal{UserID: userID, Order: order, Sum: sum}
+	err = s.withdrawals.Withdraw(ctx, w)
+	switch {
+	case errors.Is(err, models.ErrInsufficientFunds):
+		return nil, ErrInsufficientFunds
+	case errors.Is(err, models.ErrWithdrawalExists):
+		return nil, ErrWithdrawalExists
+	case err != nil:
+		return nil, ErrDB
+	}
+	return w, nil
+}
+
+// ListWithdrawals returns a page of the user's withdrawals, newest first,
+// and the cursor of the next page if there is one.
+func (s *BalanceService) ListWithdrawals(ctx context.Context, userID int, q models.PageQuery) (_ []*models.Withdrawal, _ *models.PageCursor, err error) {
+	ctx, span := tracing.Start(ctx, "BalanceService.ListWithdrawals")
+	defer func() { tracing.End(span, err) }()
+
+	limit := q.Limit
+	if limit > 0 {
+		q.Limit++
+	}
+	withdrawals, err := s.withdrawals.ListByUser(ctx, userID, q)
+	if err != nil {
+		return nil, nil, ErrDB
+	}
+
+	withdrawals, next := page(withdrawals, limit, func(w *models.Withdrawal) models.PageCursor {
+		return models.PageCursor{At: w.ProcessedAt, ID: w.ID}
+	})
+	return withdrawals, next, nil
+}
+
+// RefundWithdrawal reverses the withdrawal of the order: the sum is credited
+// back to the user and no longer counts as withdrawn. The refund is audited
+// as made by the actor.
+func (s *BalanceService) RefundWithdrawal(ctx context.Context, actorID int, order, reason string) (_ *models.Withdrawal, err error) {
+	ctx, span := tracing.Start(ctx, "BalanceService.RefundWithdrawal", attribute.String("order.number", order))
+	defer func() { tracing.End(span, err) }()
+
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ErrReasonRequired
+	}
+
+	audit := &models.AuditEntry{
+		ActorID: actorID,
+		Action:  models.AuditRefund,
+		Reason:  reason,
+		Details: map[string]any{"order": order},
+	}
+	w, err := s.withdrawals.Refund(ctx, order, reason, audit)
+	switch {
+	case errors.Is(err, models.ErrWithdrawalNotFound):
+		return nil, ErrWithdrawalNotFound
+	case errors.Is(err, models.ErrWithdrawalRefunded):
+		return nil, ErrWithdrawalRefunded
+	case err != nil:
+		return nil, ErrDB
+	}
+	return w, nil
+}
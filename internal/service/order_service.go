@@ -0,0 +1,330 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/rshafikov/gophermart/internal/accrual"
+	"github.com/rshafikov/gophermart/internal/core/logger"
+	"github.com/rshafikov/gophermart/internal/core/luhn"
+	"github.com/rshafikov/gophermart/internal/core/tracing"
+	"github.com/rshafikov/gophermart/internal/models"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+var ErrInvalidOrderNumber = errors.New("invalid order number")
+var ErrOrderAlreadyUploaded = errors.New("order has already been uploaded by this user")
+var ErrOrderOwnedByAnotherUser = errors.New("order has already been uploaded by another user")
+var ErrOrderNotFound = errors.New("order not found")
+var ErrOrderFinalized = errors.New("order is already finalized with another result")
+var ErrInvalidAccrualStatus = errors.New("invalid accrual status")
+
+// Order event sources.
+const (
+	SourceUpload  = "upload"
+	SourcePoll    = "poll"
+	SourcePush    = "push"
+	SourceRefresh = "refresh"
+)
+
+// Per-number results of UploadBatch.
+const (
+	UploadAccepted        = "accepted"
+	UploadAlreadyUploaded = "already_uploaded"
+	UploadConflict        = "conflict"
+	UploadInvalid         = "invalid"
+)
+
+type UploadResult struct {
+	Number string
+	Result string
+}
+
+// maxStatusUpdateAttempts bounds the re-reads when the status of an order
+// changes between reading and updating it.
+const maxStatusUpdateAttempts = 3
+
+type OrderService struct {
+	repo models.OrderRepository
+	// AccrualClient enables on-demand refreshes in Get; nil disables them.
+	AccrualClient accrual.Client
+}
+
+func NewOrderService(repo models.OrderRepository) *OrderService {
+	return &OrderService{repo: repo}
+}
+
+func (s *OrderService) Upload(ctx context.Context, userID int, number string) (err error) {
+	ctx, span := tracing.Start(ctx, "OrderService.Upload", attribute.String("order.number", number))
+	defer func() { tracing.End(span, err) }()
+
+	if !luhn.Valid(number) {
+		return ErrInvalidOrderNumber
+	}
+
+	err = s.repo.CreateOrder(ctx, &models.Order{Number: number, UserID: userID, Status: models.OrderStatusNew}, SourceUpload)
+	if errors.Is(err, models.ErrOrderExists) {
+		existing, getErr := s.repo.GetByNumber(ctx, number)
+		if getErr != nil {
+			return ErrDB
+		}
+		if existing.UserID == userID {
+			return ErrOrderAlreadyUploaded
+		}
+		return ErrOrderOwnedByAnotherUser
+	}
+	if err != nil {
+		return ErrDB
+	}
+
+	return nil
+}
+
+// UploadBatch uploads many order numbers at once and returns a result for
+// each of them, in order. A number repeated in the batch is reported like
+// its first occurrence, except that an accepted number is already uploaded
+// afterwards.
+func (s *OrderService) UploadBatch(ctx context.Context, userID int, numbers []string) (_ []UploadResult, err error) {
+	ctx, span := tracing.Start(ctx, "OrderService.UploadBatch", attribute.Int("orders.count", len(numbers)))
+	defer func() { tracing.End(span, err) }()
+
+	results := make([]UploadResult, len(numbers))
+	first := make(map[string]int, len(numbers))
+	var orders []*models.Order
+	for i, number := range numbers {
+		results[i].Number = number
+		if !luhn.Valid(number) {
+			results[i].Result = UploadInvalid
+			continue
+		}
+		if _, ok := first[number]; !ok {
+			first[number] = i
+			orders = append(orders, &models.Order{Number: number, UserID: userID, Status: models.OrderStatusNew})
+		}
+	}
+
+	var existing map[string]int
+	if len(orders) > 0 {
+		if existing, err = s.repo.CreateOrders(ctx, orders, SourceUpload); err != nil {
+			return nil, ErrDB
+		}
+	}
+
+	for i := range results {
+		number := results[i].Number
+		if results[i].Result != "" {
+			continue
+		}
+		if j := first[number]; j != i {
+			results[i].Result = results[j].Result
+			if results[i].Result == UploadAccepted {
+				results[i].Result = UploadAlreadyUploaded
+			}
+			continue
+		}
+
+		owner, exists := existing[number]
+		switch {
+		case !exists:
+			results[i].Result = UploadAccepted
+		case owner == userID:
+			results[i].Result = UploadAlreadyUploaded
+		default:
+			results[i].Result = UploadConflict
+		}
+	}
+	return results, nil
+}
+
+// ListByUser returns a page of the user's orders, newest first, and the
+// cursor of the next page if there is one.
+func (s *OrderService) ListByUser(ctx context.Context, userID int, q models.OrderQuery) (_ []*models.Order, _ *models.PageCursor, err error) {
+	ctx, span := tracing.Start(ctx, "OrderService.ListByUser")
+	defer func() { tracing.End(span, err) }()
+
+	limit := q.Limit
+	if limit > 0 {
+		q.Limit++
+	}
+	orders, err := s.repo.ListByUser(ctx, userID, q)
+	if err != nil {
+		return nil, nil, ErrDB
+	}
+
+	orders, next := page(orders, limit, func(o *models.Order) models.PageCursor {
+		return models.PageCursor{At: o.UploadedAt, ID: o.ID}
+	})
+	return orders, next, nil
+}
+
+// Get returns the user's order. With refresh set, a pending order is checked
+// with the accrual system right away; failures of the check are logged and
+// the stored order is returned.
+func (s *OrderService) Get(ctx context.Context, userID int, number string, refresh bool) (_ *models.Order, err error) {
+	ctx, span := tracing.Start(ctx, "OrderService.Get",
+		attribute.String("order.number", number),
+		attribute.Bool("order.refresh", refresh),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	order, err := s.ownOrder(ctx, userID, number)
+	if err != nil {
+		return nil, err
+	}
+	if !refresh || order.Status.IsFinal() || s.AccrualClient == nil {
+		return order, nil
+	}
+
+	if err := s.refresh(ctx, number); err != nil {
+		logger.L.Warn("unable to refresh order", zap.String("order", number), zap.Error(err))
+		return order, nil
+	}
+
+	order, err = s.repo.GetByNumber(ctx, number)
+	if err != nil {
+		return nil, ErrDB
+	}
+	return order, nil
+}
+
+// History returns the status changes of the user's order, oldest first.
+func (s *OrderService) History(ctx context.Context, userID int, number string) (_ []*models.OrderEvent, err error) {
+	ctx, span := tracing.Start(ctx, "OrderService.History", attribute.String("order.number", number))
+	defer func() { tracing.End(span, err) }()
+
+	order, err := s.ownOrder(ctx, userID, number)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := s.repo.ListEvents(ctx, order.ID)
+	if err != nil {
+		return nil, ErrDB
+	}
+	return events, nil
+}
+
+// ownOrder reports orders of other users as not found, so their existence
+// is not revealed.
+func (s *OrderService) ownOrder(ctx context.Context, userID int, number string) (*models.Order, error) {
+	order, err := s.repo.GetByNumber(ctx, number)
+	if errors.Is(err, models.ErrOrderNotFound) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, ErrDB
+	}
+	if order.UserID != userID {
+		return nil, ErrOrderNotFound
+	}
+	return order, nil
+}
+
+func (s *OrderService) refresh(ctx context.Context, number string) error {
+	res, err := s.AccrualClient.GetOrderAccrual(ctx, number)
+	if err != nil {
+		return err
+	}
+	return s.ApplyAccrual(ctx, SourceRefresh, res)
+}
+
+// ApplyAccrual moves the order to the status reported by the accrual system.
+// Both the poller and the push endpoint go through here. Re-applying the
+// result an order already has is a no-op, so deliveries may be repeated; a
+// different result for a finalized order yields ErrOrderFinalized.
+func (s *OrderService) ApplyAccrual(ctx context.Context, source string, res *accrual.OrderAccrual) (err error) {
+	ctx, span := tracing.Start(ctx, "OrderService.ApplyAccrual",
+		attribute.String("order.number", res.Order),
+		attribute.String("accrual.status", string(res.Status)),
+		attribute.String("accrual.source", source),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	status := orderStatusFromAccrual(res.Status)
+	if status == "" {
+		return ErrInvalidAccrualStatus
+	}
+
+	// The amount is stored in cents; round it so that a repeated delivery
+	// compares equal to what was stored.
+	var amount *float64
+	if status == models.OrderStatusProcessed && res.Accrual != nil {
+		rounded := models.RoundPoints(*res.Accrual)
+		amount = &rounded
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = s.transition(ctx, source, res.Order, status, amount)
+		if !errors.Is(err, models.ErrOrderStatusChanged) {
+			return err
+		}
+		if attempt == maxStatusUpdateAttempts {
+			return ErrDB
+		}
+	}
+}
+
+func (s *OrderService) transition(ctx context.Context, source, number string, status models.OrderStatus, amount *float64) error {
+	order, err := s.repo.GetByNumber(ctx, number)
+	if errors.Is(err, models.ErrOrderNotFound) {
+		return ErrOrderNotFound
+	}
+	if err != nil {
+		return ErrDB
+	}
+
+	if order.Status == status && equalAmounts(order.Accrual, amount) {
+		// A repeated delivery also restores a credit missing for any reason;
+		// the ledger holds at most one per order.
+		credited, err := s.repo.CreditAccrual(ctx, order)
+		if err != nil {
+			return ErrDB
+		}
+		if credited {
+			logger.L.Warn("missing accrual credit restored", zap.String("order", order.Number))
+		}
+		return nil
+	}
+	if order.Status.IsFinal() {
+		return ErrOrderFinalized
+	}
+	if err := models.ValidateTransition(order.Status, status); err != nil {
+		return err
+	}
+
+	err = s.repo.UpdateStatus(ctx, order.Number, order.Status, status, amount, source)
+	if errors.Is(err, models.ErrOrderStatusChanged) {
+		return err
+	}
+	if err != nil {
+		return ErrDB
+	}
+
+	logger.L.Debug("order status updated",
+		zap.String("order", order.Number),
+		zap.String("from", string(order.Status)),
+		zap.String("to", string(status)),
+		zap.String("source", source),
+	)
+	return nil
+}
+
+func orderStatusFromAccrual(status accrual.Status) models.OrderStatus {
+	switch status {
+	case accrual.StatusRegistered, accrual.StatusProcessing:
+		return models.OrderStatusProcessing
+	case accrual.StatusInvalid:
+		return models.OrderStatusInvalid
+	case accrual.StatusProcessed:
+		return models.OrderStatusProcessed
+	default:
+		return ""
+	}
+}
+
+func equalAmounts(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
@@ -0,0 +1,14 @@
+package service
+
+import "github.com/rshafikov/gophermart/internal/models"
+
+// page trims items fetched with limit+1 to limit and returns the cursor of
+// the next page, if there is one. A zero limit means an unpaginated listing.
+func page[T any](items []T, limit int, cursor func(T) models.PageCursor) ([]T, *models.PageCursor) {
+	if limit <= 0 || len(items) <= limit {
+		return items, nil
+	}
+	items = items[:limit]
+	next := cursor(items[limit-1])
+	return items, &next
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/rshafikov/gophermart/internal/core/tracing"
+	"github.com/rshafikov/gophermart/internal/models"
+	"strings"
+)
+
+var ErrTransferTooSmall = errors.New("amount is below the minimum transfer")
+var ErrRecipientNotFound = errors.New("recipient not found")
+var ErrSelfTransfer = errors.New("cannot transfer points to yourself")
+var ErrTransferLimitExceeded = errors.New("daily transfer limit exceeded")
+
+// TransferLimits bound the transfers of a user. A zero DailyMax disables
+// the daily limit.
+type TransferLimits struct {
+	MinAmount float64
+	DailyMax  float64
+}
+
+type TransferService struct {
+	repo   models.TransferRepository
+	limits TransferLimits
+}
+
+func NewTransferService(repo models.TransferRepository, limits TransferLimits) *TransferService {
+	return &TransferService{repo: repo, limits: limits}
+}
+
+// Transfer gifts the amount of points to the user with the recipient login.
+func (s *TransferService) Transfer(ctx context.Context, senderID int, recipient string, amount float64) (_ *models.Transfer, err error) {
+	ctx, span := tracing.Start(ctx, "TransferService.Transfer")
+	defer func() { tracing.End(span, err) }()
+
+	if amount <= 0 || models.RoundPoints(amount) != amount {
+		return nil, ErrInvalidSum
+	}
+	if amount < s.limits.MinAmount {
+		return nil, ErrTransferTooSmall
+	}
+	recipient = strings.TrimSpace(recipient)
+	if recipient == "" {
+		return nil, ErrRecipientNotFound
+	}
+
+	t := &models.Transfer{SenderID: senderID, RecipientLogin: recipient, Amount: amount}
+	err = s.repo.Transfer(ctx, t, s.limits.DailyMax)
+	switch {
+	case errors.Is(err, models.ErrRecipientNotFound):
+		return nil, ErrRecipientNotFound
+	case errors.Is(err, models.ErrSelfTransfer):
+		return nil, ErrSelfTransfer
+	case errors.Is(err, models.ErrTransferLimitExceeded):
+		return nil, ErrTransferLimitExceeded
+	case errors.Is(err, models.ErrInsufficientFunds):
+		return nil, ErrInsufficientFunds
+	case err != nil:
+		return nil, ErrDB
+	}
+	return t, nil
+}
+
+// ListByUser returns a page of the transfers sent or received by the user,
+// newest first, and the cursor of the next page if there is one.
+func (s *TransferService) ListByUser(ctx context.Context, userID int, q models.PageQuery) (_ []*models.Transfer, _ *models.PageCursor, err error) {
+	ctx, span := tracing.Start(ctx, "TransferService.ListByUser")
+	defer func() { tracing.End(span, err) }()
+
+	limit := q.Limit
+	if limit > 0 {
+		q.Limit++
+	}
+	transfers, err := s.repo.ListByUser(ctx, userID, q)
+	if err != nil {
+		return nil, nil, ErrDB
+	}
+
+	transfers, next := page(transfers, limit, func(t *models.Transfer) models.PageCursor {
+		return models.PageCursor{At: t.CreatedAt, ID: t.ID}
+	})
+	return transfers, next, nil
+}
@@ -4,14 +4,19 @@ import (
 	"context"
 	"errors"
 	"github.com/rshafikov/gophermart/internal/core/security"
+	"github.com/rshafikov/gophermart/internal/core/tracing"
 	"github.com/rshafikov/gophermart/internal/models"
+	"go.opentelemetry.io/otel/attribute"
 	"log"
+	"strings"
 )
 
 var ErrPasswordMismatch = errors.New("password mismatch")
 var ErrUserNotFound = errors.New("user not found")
 var ErrUserAlreadyExists = errors.New("login is not available")
 var ErrDB = errors.New("database error")
+var ErrInvalidRole = errors.New("invalid role")
+var ErrInvalidLogin = errors.New("invalid login")
 
 type UserService struct {
 	repo models.UserRepository
@@ -21,18 +26,24 @@ func NewUserService(repo models.UserRepository) *UserService {
 	return &UserService{repo: repo}
 }
 
-func (s *UserService) Register(ctx context.Context, login, password string) error {
+func (s *UserService) Register(ctx context.Context, login, password string) (err error) {
+	ctx, span := tracing.Start(ctx, "UserService.Register", attribute.String("user.login", login))
+	defer func() { tracing.End(span, err) }()
+
+	if !security.IsLoginValid(login) {
+		return ErrInvalidLogin
+	}
 	oldUser, _ := s.repo.GetByLogin(ctx, login)
 	if oldUser != nil {
 		return ErrUserAlreadyExists
 	}
 
-	password, err := security.HashPassword(password)
+	password, err = security.HashPassword(password)
 	if err != nil {
 		return ErrDB
 	}
 
-	err = s.repo.CreateUser(ctx, &models.User{Login: login, Password: password})
+	err = s.repo.CreateUser(ctx, &models.User{Login: login, Password: password, Role: models.RoleUser})
 	if err != nil {
 		return ErrDB
 	}
@@ -40,7 +51,10 @@ func (s *UserService) Register(ctx context.Context, login, password string) erro
 	return nil
 }
 
-func (s *UserService) Login(ctx context.Context, login, password string) (*models.User, error) {
+func (s *UserService) Login(ctx context.Context, login, password string) (_ *models.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.Login", attribute.String("user.login", login))
+	defer func() { tracing.End(span, err) }()
+
 	user, err := s.repo.GetByLogin(ctx, login)
 	if err != nil {
 		log.Println("unable to GET user by login:", err)
@@ -55,7 +69,10 @@ func (s *UserService) Login(ctx context.Context, login, password string) (*model
 	return user, nil
 }
 
-func (s *UserService) GetByLogin(ctx context.Context, login string) (*models.User, error) {
+func (s *UserService) GetByLogin(ctx context.Context, login string) (_ *models.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetByLogin", attribute.String("user.login", login))
+	defer func() { tracing.End(span, err) }()
+
 	user, err := s.repo.GetByLogin(ctx, login)
 	if err != nil {
 		log.Println("unable to GET user by login:", err)
@@ -64,3 +81,46 @@ func (s *UserService) GetByLogin(ctx context.Context, login string) (*models.Use
 
 	return user, nil
 }
+
+// Delete anonymizes the account of the user once the password is confirmed.
+// The login becomes available again; orders and ledger entries are kept
+// under the anonymized account.
+func (s *UserService) Delete(ctx context.Context, login, password string) (err error) {
+	ctx, span := tracing.Start(ctx, "UserService.Delete", attribute.String("user.login", login))
+	defer func() { tracing.End(span, err) }()
+
+	user, err := s.Login(ctx, login, password)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Anonymize(ctx, user.ID); err != nil {
+		return ErrDB
+	}
+	return nil
+}
+
+// SetRole changes the role of the user on behalf of the actor. Tokens issued
+// with the old role stop being accepted.
+func (s *UserService) SetRole(ctx context.Context, actorID int, login string, role models.Role, reason string) (err error) {
+	ctx, span := tracing.Start(ctx, "UserService.SetRole", attribute.String("user.login", login))
+	defer func() { tracing.End(span, err) }()
+
+	if !role.Valid() {
+		return ErrInvalidRole
+	}
+	user, err := s.repo.GetByLogin(ctx, login)
+	if err != nil {
+		return ErrUserNotFound
+	}
+
+	audit := &models.AuditEntry{
+		ActorID: actorID,
+		Action:  models.AuditRoleChange,
+		Reason:  strings.TrimSpace(reason),
+		Details: map[string]any{"from": user.Role, "to": role},
+	}
+	if err := s.repo.SetRole(ctx, login, role, audit); err != nil {
+		return ErrDB
+	}
+	return nil
+}
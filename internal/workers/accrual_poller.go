@@ -0,0 +1,237 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"github.com/rshafikov/gophermart/internal/accrual"
+	"github.com/rshafikov/gophermart/internal/core/logger"
+	"github.com/rshafikov/gophermart/internal/models"
+	"github.com/rshafikov/gophermart/internal/service"
+	"go.uber.org/zap"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBatchSize       = 100
+	DefaultLeaseTimeout    = 30 * time.Second
+	DefaultMaxAttempts     = 10
+	DefaultRetryBackoff    = 5 * time.Second
+	DefaultRetryMaxBackoff = 10 * time.Minute
+)
+
+type AccrualPollerConfig struct {
+	// Interval is how often due jobs are leased and how soon an order that
+	// is not final yet is checked again.
+	Interval time.Duration
+	Workers  int
+	// BatchSize is the number of jobs leased at once.
+	BatchSize int
+	// LeaseTimeout is how long a leased job stays invisible to other
+	// workers. A job abandoned by a crashed replica is retried after it.
+	LeaseTimeout time.Duration
+	// MaxAttempts is the number of consecutive failures after which a job
+	// is moved to the dead-letter state.
+	MaxAttempts int
+	// RetryBackoff and RetryMaxBackoff bound the jittered delay before a
+	// failed job is retried. It doubles with every attempt.
+	RetryBackoff    time.Duration
+	RetryMaxBackoff time.Duration
+}
+
+// AccrualPoller works off the accrual job queue: it leases due jobs, asks the
+// accrual system about their orders and applies the answers through
+// service.OrderService. Any number of replicas may poll the same queue.
+type AccrualPoller struct {
+	orders *service.OrderService
+	jobs   models.AccrualJobQueue
+	client accrual.Client
+	cfg    AccrualPollerConfig
+}
+
+func NewAccrualPoller(orders *service.OrderService, jobs models.AccrualJobQueue, client accrual.Client, cfg AccrualPollerConfig) *AccrualPoller {
+	cfg.Workers = max(cfg.Workers, 1)
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultBatchSize
+	}
+	if cfg.LeaseTimeout <= 0 {
+		cfg.LeaseTimeout = DefaultLeaseTimeout
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultMaxAttempts
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = DefaultRetryBackoff
+	}
+	if cfg.RetryMaxBackoff < cfg.RetryBackoff {
+		cfg.RetryMaxBackoff = max(DefaultRetryMaxBackoff, cfg.RetryBackoff)
+	}
+	return &AccrualPoller{orders: orders, jobs: jobs, client: client, cfg: cfg}
+}
+
+// Run polls until ctx is cancelled. When the accrual system answers 429 all
+// workers pause for the advertised Retry-After.
+func (p *AccrualPoller) Run(ctx context.Context) {
+	logger.L.Info("accrual poller started", zap.Int("workers", p.cfg.Workers), zap.Duration("interval", p.cfg.Interval))
+	defer logger.L.Info("accrual poller stopped")
+
+	for {
+		wait := p.cfg.Interval
+		if pause := p.Poll(ctx); pause > wait {
+			wait = pause
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Poll processes one batch of due jobs and returns how long the accrual
+// system asked us to back off, if it did. Jobs left unchecked because of the
+// back-off are released without counting the attempt.
+func (p *AccrualPoller) Poll(ctx context.Context) time.Duration {
+	jobs, err := p.jobs.Lease(ctx, p.cfg.BatchSize, p.cfg.LeaseTimeout)
+	if err != nil {
+		logger.L.Error("unable to lease accrual jobs", zap.Error(err))
+		return 0
+	}
+	if len(jobs) == 0 {
+		return 0
+	}
+
+	// checkCtx is cancelled on 429 to stop the remaining checks; job updates
+	// still use ctx.
+	checkCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	queue := make(chan *models.AccrualJob)
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		pause     time.Duration
+		unchecked []*models.AccrualJob
+	)
+
+	for range p.cfg.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				err := checkCtx.Err()
+				if err == nil {
+					err = p.process(ctx, checkCtx, job)
+				}
+				if err == nil {
+					continue
+				}
+
+				mu.Lock()
+				var rlErr *accrual.RateLimitError
+				if errors.As(err, &rlErr) {
+					pause = max(pause, rlErr.RetryAfter, p.cfg.Interval)
+					cancel()
+				}
+				unchecked = append(unchecked, job)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		// Shutting down: leases expire and other replicas pick the jobs up.
+		return pause
+	}
+	runAt := time.Now().Add(pause)
+	for _, job := range unchecked {
+		p.update(job, p.jobs.Release(ctx, job, runAt))
+	}
+
+	return pause
+}
+
+// process checks one job and updates it. It returns an error only when the
+// order was not checked, because of a 429, an open circuit or a cancelled
+// checkCtx; the job is then left for the caller to release. An order the
+// accrual system does not know yet is checked again after the interval.
+func (p *AccrualPoller) process(ctx, checkCtx context.Context, job *models.AccrualJob) error {
+	res, err := p.client.GetOrderAccrual(checkCtx, job.OrderNumber)
+	if err != nil {
+		var rlErr *accrual.RateLimitError
+		switch {
+		case errors.As(err, &rlErr):
+			logger.L.Warn("accrual system rate limit hit", zap.Duration("retry_after", rlErr.RetryAfter))
+			return err
+		case errors.Is(err, accrual.ErrCircuitOpen):
+			return err
+		case checkCtx.Err() != nil:
+			return checkCtx.Err()
+		case errors.Is(err, accrual.ErrOrderNotRegistered):
+			p.update(job, p.jobs.Reschedule(ctx, job, time.Now().Add(p.cfg.Interval)))
+			return nil
+		}
+		p.fail(ctx, job, err)
+		return nil
+	}
+
+	err = p.orders.ApplyAccrual(ctx, service.SourcePoll, res)
+	switch {
+	case errors.Is(err, service.ErrOrderNotFound), errors.Is(err, service.ErrOrderFinalized):
+		logger.L.Warn("accrual result is not applicable, dropping job", zap.String("order", job.OrderNumber), zap.Error(err))
+		p.update(job, p.jobs.Complete(ctx, job))
+	case err != nil:
+		p.fail(ctx, job, err)
+	case res.Status == accrual.StatusProcessed || res.Status == accrual.StatusInvalid:
+		p.update(job, p.jobs.Complete(ctx, job))
+	default:
+		p.update(job, p.jobs.Reschedule(ctx, job, time.Now().Add(p.cfg.Interval)))
+	}
+	return nil
+}
+
+func (p *AccrualPoller) fail(ctx context.Context, job *models.AccrualJob, cause error) {
+	if job.Attempts >= p.cfg.MaxAttempts {
+		logger.L.Error("accrual job moved to dead letter",
+			zap.String("order", job.OrderNumber),
+			zap.Int("attempts", job.Attempts),
+			zap.Error(cause),
+		)
+		p.update(job, p.jobs.Bury(ctx, job, cause.Error()))
+		return
+	}
+
+	delay := p.backoff(job.Attempts)
+	logger.L.Warn("accrual job failed, retrying",
+		zap.String("order", job.OrderNumber),
+		zap.Int("attempts", job.Attempts),
+		zap.Duration("retry_in", delay),
+		zap.Error(cause),
+	)
+	p.update(job, p.jobs.Retry(ctx, job, time.Now().Add(delay), cause.Error()))
+}
+
+func (p *AccrualPoller) update(job *models.AccrualJob, err error) {
+	if err != nil {
+		logger.L.Warn("unable to update accrual job", zap.String("order", job.OrderNumber), zap.Error(err))
+	}
+}
+
+// backoff returns an "equal jitter" delay for the given attempt, starting
+// at 1: half of min(max, initial*2^(attempt-1)) plus a random part of the
+// other half, so retries of orders that failed together spread out.
+func (p *AccrualPoller) backoff(attempt int) time.Duration {
+	ceiling := p.cfg.RetryBackoff << min(max(attempt-1, 0), 30)
+	if ceiling <= 0 || ceiling > p.cfg.RetryMaxBackoff {
+		ceiling = p.cfg.RetryMaxBackoff
+	}
+	return ceiling/2 + rand.N(ceiling/2+1)
+}
@@ -0,0 +1,241 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"github.com/rshafikov/gophermart/internal/accrual"
+	"github.com/rshafikov/gophermart/internal/models"
+	"github.com/rshafikov/gophermart/internal/repository"
+	"github.com/rshafikov/gophermart/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestPoller(t *testing.T, client accrual.Client, cfg AccrualPollerConfig, numbers ...string) (*AccrualPoller, *repository.MockOrderRepository) {
+	orderRepo := repository.NewMockOrderRepository()
+	orderService := service.NewOrderService(orderRepo)
+	for _, number := range numbers {
+		require.NoError(t, orderService.Upload(context.TODO(), 1, number))
+	}
+	return NewAccrualPoller(orderService, orderRepo.Jobs, client, cfg), orderRepo
+}
+
+func TestAccrualPoller_Poll(t *testing.T) {
+	ctx := context.TODO()
+	amount := 500.0
+	client := accrual.NewMockClient()
+	client.Set("12345678903", accrual.StatusProcessed, &amount)
+	client.Set("9278923470", accrual.StatusRegistered, nil)
+	client.Set("346436439", accrual.StatusInvalid, nil)
+
+	poller, orderRepo := newTestPoller(t, client, AccrualPollerConfig{Interval: time.Minute, Workers: 2},
+		"12345678903", "9278923470", "346436439", "2377225624")
+	assert.Zero(t, poller.Poll(ctx))
+
+	tests := []struct {
+		number   string
+		status   models.OrderStatus
+		job      models.AccrualJobStatus
+		attempts int
+	}{
+		{number: "12345678903", status: models.OrderStatusProcessed, job: models.AccrualJobDone, attempts: 1},
+		{number: "9278923470", status: models.OrderStatusProcessing, job: models.AccrualJobPending, attempts: 0},
+		{number: "346436439", status: models.OrderStatusInvalid, job: models.AccrualJobDone, attempts: 1},
+		{number: "2377225624", status: models.OrderStatusNew, job: models.AccrualJobPending, attempts: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.number, func(t *testing.T) {
+			order, err := orderRepo.GetByNumber(ctx, test.number)
+			require.NoError(t, err)
+			assert.Equal(t, test.status, order.Status)
+
+			job, ok := orderRepo.Jobs.Get(test.number)
+			require.True(t, ok)
+			assert.Equal(t, test.job, job.Status)
+			assert.Equal(t, test.attempts, job.Attempts)
+			assert.Nil(t, job.LockedUntil, "lease is given back")
+		})
+	}
+
+	processing, _ := orderRepo.Jobs.Get("9278923470")
+	assert.WithinDuration(t, time.Now().Add(time.Minute), processing.NextRunAt, time.Second, "re-checked after the interval")
+
+	// The accrual system may register an order late: it is not a failure.
+	unknown, _ := orderRepo.Jobs.Get("2377225624")
+	assert.Nil(t, unknown.LastError)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), unknown.NextRunAt, time.Second, "re-checked after the interval")
+
+	calls := client.Calls
+	assert.Zero(t, poller.Poll(ctx))
+	assert.Equal(t, calls, client.Calls, "nothing is due yet")
+}
+
+func TestAccrualPoller_PausesOnRateLimit(t *testing.T) {
+	ctx := context.TODO()
+	client := accrual.NewMockClient()
+	client.Err = &accrual.RateLimitError{RetryAfter: time.Minute}
+
+	poller, orderRepo := newTestPoller(t, client, AccrualPollerConfig{Interval: time.Second, Workers: 1},
+		"12345678903", "9278923470")
+
+	assert.Equal(t, time.Minute, poller.Poll(ctx))
+	assert.Equal(t, 1, client.Calls, "remaining orders are not requested while rate limited")
+
+	for _, number := range []string{"12345678903", "9278923470"} {
+		job, ok := orderRepo.Jobs.Get(number)
+		require.True(t, ok)
+		assert.Equal(t, models.AccrualJobPending, job.Status)
+		assert.Zero(t, job.Attempts, "rate limited checks are not counted")
+		assert.Nil(t, job.LockedUntil)
+		assert.WithinDuration(t, time.Now().Add(time.Minute), job.NextRunAt, time.Second)
+	}
+}
+
+func TestAccrualPoller_ReleasesOnOpenCircuit(t *testing.T) {
+	ctx := context.TODO()
+	client := accrual.NewMockClient()
+	client.Err = accrual.ErrCircuitOpen
+
+	poller, orderRepo := newTestPoller(t, client, AccrualPollerConfig{Interval: time.Second, MaxAttempts: 1}, "12345678903")
+	for range 3 {
+		poller.Poll(ctx)
+	}
+
+	job, ok := orderRepo.Jobs.Get("12345678903")
+	require.True(t, ok)
+	assert.Equal(t, models.AccrualJobPending, job.Status, "an outage does not use up attempts")
+	assert.Zero(t, job.Attempts)
+	assert.Nil(t, job.LockedUntil)
+}
+
+func TestAccrualPoller_DeadLetter(t *testing.T) {
+	ctx := context.TODO()
+	client := accrual.NewMockClient()
+	client.Err = accrual.ErrUnavailable
+
+	poller, orderRepo := newTestPoller(t, client, AccrualPollerConfig{
+		Interval:        time.Second,
+		MaxAttempts:     2,
+		RetryBackoff:    time.Second,
+		RetryMaxBackoff: time.Second,
+	}, "12345678903")
+
+	poller.Poll(ctx)
+	job, _ := orderRepo.Jobs.Get("12345678903")
+	assert.Equal(t, models.AccrualJobPending, job.Status)
+	assert.Equal(t, 1, job.Attempts)
+
+	orderRepo.Jobs.Now = func() time.Time { return time.Now().Add(time.Hour) }
+	poller.Poll(ctx)
+	job, _ = orderRepo.Jobs.Get("12345678903")
+	assert.Equal(t, models.AccrualJobDead, job.Status)
+	require.NotNil(t, job.LastError)
+	assert.Contains(t, *job.LastError, accrual.ErrUnavailable.Error())
+
+	poller.Poll(ctx)
+	assert.Equal(t, 2, client.Calls, "dead jobs are not leased again")
+}
+
+func TestAccrualPoller_CreditsOnce(t *testing.T) {
+	ctx := context.TODO()
+	amount := 729.98
+	client := accrual.NewMockClient()
+	client.Set("12345678903", accrual.StatusProcessed, &amount)
+
+	poller, orderRepo := newTestPoller(t, client, AccrualPollerConfig{Interval: time.Second}, "12345678903")
+	later := func(d time.Duration) { orderRepo.Jobs.Now = func() time.Time { return time.Now().Add(d) } }
+
+	// The process dies between the order update and the credit: the
+	// transaction is rolled back and the job is retried.
+	orderRepo.CreditErr = errors.New("connection reset")
+	poller.Poll(ctx)
+	order, _ := orderRepo.GetByNumber(ctx, "12345678903")
+	assert.Equal(t, models.OrderStatusNew, order.Status)
+	assert.Empty(t, orderRepo.Ledger.Credits("12345678903"))
+
+	later(time.Hour)
+	poller.Poll(ctx)
+	order, _ = orderRepo.GetByNumber(ctx, "12345678903")
+	assert.Equal(t, models.OrderStatusProcessed, order.Status)
+	assert.Len(t, orderRepo.Ledger.Credits("12345678903"), 1)
+
+	// The process dies after the commit but before completing the job: the
+	// job is delivered again once its lease expires.
+	require.NoError(t, orderRepo.Jobs.Enqueue(ctx, "12345678903"))
+	later(2 * time.Hour)
+	poller.Poll(ctx)
+	assert.Len(t, orderRepo.Ledger.Credits("12345678903"), 1)
+
+	balance, err := orderRepo.Ledger.GetBalance(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, amount, balance.Current)
+}
+
+func TestAccrualPoller_RestoresMissingCredit(t *testing.T) {
+	ctx := context.TODO()
+	amount := 100.0
+	client := accrual.NewMockClient()
+	client.Set("12345678903", accrual.StatusProcessed, &amount)
+
+	poller, orderRepo := newTestPoller(t, client, AccrualPollerConfig{Interval: time.Second}, "12345678903")
+	orderRepo.DB["12345678903"].Status = models.OrderStatusProcessed
+	orderRepo.DB["12345678903"].Accrual = &amount
+
+	poller.Poll(ctx)
+	poller.Poll(ctx)
+
+	assert.Len(t, orderRepo.Ledger.Credits("12345678903"), 1)
+}
+
+func TestAccrualPoller_RacesWithPush(t *testing.T) {
+	ctx := context.TODO()
+	amount := 42.5
+	client := accrual.NewMockClient()
+	client.Set("12345678903", accrual.StatusProcessed, &amount)
+
+	poller, orderRepo := newTestPoller(t, client, AccrualPollerConfig{Interval: time.Second}, "12345678903")
+	orderService := service.NewOrderService(orderRepo)
+	res := &accrual.OrderAccrual{Order: "12345678903", Status: accrual.StatusProcessed, Accrual: &amount}
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, orderService.ApplyAccrual(ctx, service.SourcePush, res))
+		}()
+	}
+	poller.Poll(ctx)
+	wg.Wait()
+
+	assert.Len(t, orderRepo.Ledger.Credits("12345678903"), 1)
+	events, err := orderRepo.ListEvents(ctx, 1)
+	require.NoError(t, err)
+	assert.Len(t, events, 2, "NEW and PROCESSED only")
+}
+
+func TestMockAccrualJobQueue_Lease(t *testing.T) {
+	ctx := context.TODO()
+	queue := repository.NewMockAccrualJobQueue()
+	require.NoError(t, queue.Enqueue(ctx, "12345678903"))
+	require.NoError(t, queue.Enqueue(ctx, "9278923470"))
+
+	first, err := queue.Lease(ctx, 1, time.Minute)
+	require.NoError(t, err)
+	second, err := queue.Lease(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, first, 1)
+	require.Len(t, second, 1)
+	assert.NotEqual(t, first[0].OrderNumber, second[0].OrderNumber, "leased jobs are invisible to others")
+
+	queue.Now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	expired, err := queue.Lease(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	assert.Len(t, expired, 2, "jobs of a crashed worker are leased again after the visibility timeout")
+	assert.Equal(t, 2, expired[0].Attempts)
+
+	assert.ErrorIs(t, queue.Complete(ctx, first[0]), models.ErrLeaseLost, "stale lease holder")
+}
@@ -0,0 +1,45 @@
+package workers
+
+import (
+	"context"
+	"github.com/rshafikov/gophermart/internal/core/logger"
+	"github.com/rshafikov/gophermart/internal/models"
+	"go.uber.org/zap"
+	"time"
+)
+
+const DefaultIdempotencyCleanupInterval = 10 * time.Minute
+
+// IdempotencyCleaner periodically deletes expired idempotency keys. Expired
+// keys are never replayed, so it only keeps the table small.
+type IdempotencyCleaner struct {
+	keys     models.IdempotencyRepository
+	interval time.Duration
+}
+
+func NewIdempotencyCleaner(keys models.IdempotencyRepository, interval time.Duration) *IdempotencyCleaner {
+	if interval <= 0 {
+		interval = DefaultIdempotencyCleanupInterval
+	}
+	return &IdempotencyCleaner{keys: keys, interval: interval}
+}
+
+// Run cleans up until ctx is cancelled.
+func (c *IdempotencyCleaner) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.interval):
+		}
+
+		n, err := c.keys.DeleteExpired(ctx)
+		if err != nil {
+			logger.L.Error("unable to delete expired idempotency keys", zap.Error(err))
+			continue
+		}
+		if n > 0 {
+			logger.L.Debug("expired idempotency keys deleted", zap.Int64("count", n))
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package workers
+
+import (
+	"context"
+	"github.com/rshafikov/gophermart/internal/core/logger"
+	"github.com/rshafikov/gophermart/internal/service"
+	"go.uber.org/zap"
+	"time"
+)
+
+const DefaultExpirationInterval = 24 * time.Hour
+
+// PointsExpirer writes off expired points, once at start and then every
+// interval.
+type PointsExpirer struct {
+	balance  *service.BalanceService
+	interval time.Duration
+}
+
+func NewPointsExpirer(balance *service.BalanceService, interval time.Duration) *PointsExpirer {
+	if interval <= 0 {
+		interval = DefaultExpirationInterval
+	}
+	return &PointsExpirer{balance: balance, interval: interval}
+}
+
+// Run expires points until ctx is cancelled.
+func (e *PointsExpirer) Run(ctx context.Context) {
+	logger.L.Info("points expirer started", zap.Duration("interval", e.interval))
+	defer logger.L.Info("points expirer stopped")
+
+	for {
+		total, err := e.balance.ExpirePoints(ctx, time.Now())
+		if err != nil && ctx.Err() == nil {
+			logger.L.Error("unable to expire points", zap.Error(err))
+		} else if total > 0 {
+			logger.L.Info("points expired", zap.Float64("total", total))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.interval):
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package workers
+
+import (
+	"context"
+	"github.com/rshafikov/gophermart/internal/models"
+	"github.com/rshafikov/gophermart/internal/repository"
+	"github.com/rshafikov/gophermart/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestBalanceService_ExpirePoints(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Now()
+	ledger := repository.NewMockLedgerRepository()
+	ledger.Entries = []*models.LedgerEntry{
+		{ID: 1, UserID: 1, Kind: models.LedgerAccrual, Amount: 100, CreatedAt: now.AddDate(0, -4, 0)},
+		{ID: 2, UserID: 1, Kind: models.LedgerAccrual, Amount: 50, CreatedAt: now.AddDate(0, -2, 0)},
+		{ID: 3, UserID: 1, Kind: models.LedgerWithdrawal, Amount: -30, CreatedAt: now.AddDate(0, -3, 0)},
+		{ID: 4, UserID: 2, Kind: models.LedgerAccrual, Amount: 10, CreatedAt: now.AddDate(0, -1, 0)},
+	}
+	balanceService := service.NewBalanceService(ledger, repository.NewMockWithdrawalRepository(ledger), repository.NewMockOrderRepository())
+	balanceService.Expiry = models.ExpiryPolicy{Months: 3}
+
+	total, err := balanceService.ExpirePoints(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, 70.0, total, "what is left of the first accrual")
+	userIDs, err := ledger.ListUsersWithExpiredCredits(ctx, balanceService.Expiry, now)
+	require.NoError(t, err)
+	assert.Empty(t, userIDs, "users whose expired points were written off are skipped")
+
+	total, err = balanceService.ExpirePoints(ctx, now)
+	require.NoError(t, err)
+	assert.Zero(t, total, "expired points are written off once")
+
+	balance, err := balanceService.GetBalance(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 50.0, balance.Current)
+	assert.Equal(t, 30.0, balance.Withdrawn)
+	require.Len(t, balance.Expiring, 1)
+	assert.Equal(t, 50.0, balance.Expiring[0].Amount)
+
+	balance, err = balanceService.GetBalance(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 10.0, balance.Current)
+}
+
+func TestBalanceService_WithdrawExpiredPoints(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Now()
+	ledger := repository.NewMockLedgerRepository()
+	ledger.Expiry = models.ExpiryPolicy{Months: 3}
+	ledger.Entries = []*models.LedgerEntry{
+		{ID: 1, UserID: 1, Kind: models.LedgerAccrual, Amount: 100, CreatedAt: now.AddDate(0, -4, 0)},
+		{ID: 2, UserID: 1, Kind: models.LedgerAccrual, Amount: 50, CreatedAt: now.AddDate(0, -2, 0)},
+	}
+	balanceService := service.NewBalanceService(ledger, repository.NewMockWithdrawalRepository(ledger), repository.NewMockOrderRepository())
+	balanceService.Expiry = ledger.Expiry
+	transfers := repository.NewMockTransferRepository(ledger)
+	transfers.Users["user_2"] = 2
+	transferService := service.NewTransferService(transfers, service.TransferLimits{})
+
+	// The expirer has not run yet: the first accrual is still in the balance.
+	_, err := balanceService.Withdraw(ctx, 1, "2377225624", 60)
+	assert.ErrorIs(t, err, service.ErrInsufficientFunds)
+	_, err = transferService.Transfer(ctx, 1, "user_2", 60)
+	assert.ErrorIs(t, err, service.ErrInsufficientFunds)
+	support := &models.User{ID: 2, Role: models.RoleSupport}
+	_, err = balanceService.Adjust(ctx, support, &models.User{ID: 1, Role: models.RoleUser}, -60, "fraud")
+	assert.ErrorIs(t, err, service.ErrInsufficientFunds)
+
+	_, err = balanceService.Withdraw(ctx, 1, "2377225624", 40)
+	require.NoError(t, err)
+	balance, err := balanceService.GetBalance(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 10.0, balance.Current, "expired points are written off by the debit")
+
+	total, err := balanceService.ExpirePoints(ctx, now)
+	require.NoError(t, err)
+	assert.Zero(t, total)
+}
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS orders
+(
+    id          SERIAL PRIMARY KEY,
+    number      TEXT           NOT NULL UNIQUE,
+    user_id     INTEGER        NOT NULL REFERENCES users (id),
+    status      TEXT           NOT NULL DEFAULT 'NEW',
+    accrual     NUMERIC(12, 2),
+    uploaded_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at  TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS orders_user_id_uploaded_at_idx ON orders (user_id, uploaded_at DESC);
+CREATE INDEX IF NOT EXISTS orders_pending_idx ON orders (updated_at) WHERE status IN ('NEW', 'PROCESSING');
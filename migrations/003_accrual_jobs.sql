@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS accrual_jobs
+(
+    order_number TEXT    NOT NULL PRIMARY KEY REFERENCES orders (number) ON DELETE CASCADE,
+    status       TEXT    NOT NULL DEFAULT 'PENDING',
+    attempts     INTEGER NOT NULL DEFAULT 0,
+    next_run_at  TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    locked_until TIMESTAMP WITH TIME ZONE,
+    last_error   TEXT,
+    created_at   TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at   TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS accrual_jobs_due_idx ON accrual_jobs (next_run_at) WHERE status = 'PENDING';
+
+INSERT INTO accrual_jobs (order_number)
+SELECT number FROM orders WHERE status IN ('NEW', 'PROCESSING')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS order_events
+(
+    id          SERIAL PRIMARY KEY,
+    order_id    INTEGER NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+    from_status TEXT,
+    to_status   TEXT    NOT NULL,
+    accrual     NUMERIC(12, 2),
+    source      TEXT    NOT NULL,
+    created_at  TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS order_events_order_id_idx ON order_events (order_id, id);
+
+-- Orders uploaded before events were recorded get their creation and current
+-- status reconstructed.
+INSERT INTO order_events (order_id, from_status, to_status, source, created_at)
+SELECT o.id, NULL, 'NEW', 'migration', o.uploaded_at
+FROM orders o
+WHERE NOT EXISTS (SELECT 1 FROM order_events e WHERE e.order_id = o.id);
+
+INSERT INTO order_events (order_id, from_status, to_status, accrual, source, created_at)
+SELECT o.id, 'NEW', o.status, o.accrual, 'migration', o.updated_at
+FROM orders o
+WHERE o.status <> 'NEW'
+  AND NOT EXISTS (SELECT 1 FROM order_events e WHERE e.order_id = o.id AND e.to_status = o.status);
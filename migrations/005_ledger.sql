@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS ledger_entries
+(
+    id           BIGSERIAL PRIMARY KEY,
+    user_id      INTEGER        NOT NULL REFERENCES users (id),
+    kind         TEXT           NOT NULL,
+    amount       NUMERIC(12, 2) NOT NULL,
+    order_number TEXT,
+    created_at   TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS ledger_entries_user_id_idx ON ledger_entries (user_id, id);
+
+-- An order's accrual is credited at most once.
+CREATE UNIQUE INDEX IF NOT EXISTS ledger_entries_accrual_order_uidx ON ledger_entries (order_number) WHERE kind = 'ACCRUAL';
+
+INSERT INTO ledger_entries (user_id, kind, amount, order_number, created_at)
+SELECT user_id, 'ACCRUAL', accrual, number, updated_at
+FROM orders
+WHERE status = 'PROCESSED' AND accrual > 0
+ON CONFLICT (order_number) WHERE kind = 'ACCRUAL' DO NOTHING;
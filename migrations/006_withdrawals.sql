@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS withdrawals
+(
+    id           SERIAL PRIMARY KEY,
+    user_id      INTEGER        NOT NULL REFERENCES users (id),
+    order_number TEXT           NOT NULL UNIQUE,
+    sum          NUMERIC(12, 2) NOT NULL CHECK (sum > 0),
+    processed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS withdrawals_user_id_processed_at_idx ON withdrawals (user_id, processed_at DESC, id DESC);
+
+-- Keyset pagination of orders sorts by (uploaded_at, id).
+CREATE INDEX IF NOT EXISTS orders_user_id_uploaded_at_id_idx ON orders (user_id, uploaded_at DESC, id DESC);
+DROP INDEX IF EXISTS orders_user_id_uploaded_at_idx;
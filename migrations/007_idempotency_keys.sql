@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys
+(
+    user_id      INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    key          TEXT    NOT NULL,
+    request_hash TEXT    NOT NULL,
+    status_code  INTEGER,
+    content_type TEXT,
+    body         BYTEA,
+    created_at   TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    expires_at   TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (user_id, key)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
@@ -0,0 +1,5 @@
+ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS refunded_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS refund_reason TEXT;
+
+-- A withdrawal is refunded at most once.
+CREATE UNIQUE INDEX IF NOT EXISTS ledger_entries_refund_order_uidx ON ledger_entries (order_number) WHERE kind = 'REFUND';
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS transfers
+(
+    id           SERIAL PRIMARY KEY,
+    sender_id    INTEGER        NOT NULL REFERENCES users (id),
+    recipient_id INTEGER        NOT NULL REFERENCES users (id) CHECK (recipient_id <> sender_id),
+    amount       NUMERIC(12, 2) NOT NULL CHECK (amount > 0),
+    created_at   TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS transfers_sender_id_created_at_idx ON transfers (sender_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS transfers_recipient_id_created_at_idx ON transfers (recipient_id, created_at DESC, id DESC);
+
+-- Both entries of a transfer point at it.
+ALTER TABLE ledger_entries ADD COLUMN IF NOT EXISTS transfer_id INTEGER REFERENCES transfers (id);
@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'user';
+
+-- Manual adjustments carry the reason given by support staff.
+ALTER TABLE ledger_entries ADD COLUMN IF NOT EXISTS reason TEXT;
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS audit_log
+(
+    id         SERIAL PRIMARY KEY,
+    actor_id   INTEGER NOT NULL REFERENCES users (id),
+    user_id    INTEGER NOT NULL REFERENCES users (id),
+    action     TEXT    NOT NULL,
+    reason     TEXT    NOT NULL DEFAULT '',
+    details    JSONB,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_created_at_idx ON audit_log (created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS audit_log_actor_id_created_at_idx ON audit_log (actor_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS audit_log_user_id_created_at_idx ON audit_log (user_id, created_at DESC, id DESC);
+
+-- The log is append-only.
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS
+$$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log;
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
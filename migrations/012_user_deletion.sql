@@ -0,0 +1,3 @@
+-- Deleted accounts keep their row, and so their ledger, under an
+-- anonymized login.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,3 @@
+-- A reservation whose request never completed may be taken over once its
+-- lease ends instead of blocking the key until it expires.
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,3 @@
+-- The points expirer looks up the latest expiration of every user with
+-- expired credits.
+CREATE INDEX IF NOT EXISTS ledger_entries_expiration_idx ON ledger_entries (user_id, created_at) WHERE kind = 'EXPIRATION';